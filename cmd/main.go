@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
 	"p2p-call/internal/audio/codec"
 	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/device"
+	"p2p-call/internal/audio/dsp"
 	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/metrics"
+	"p2p-call/internal/nettest"
+	"p2p-call/internal/p2p/base"
 	"p2p-call/internal/rtc"
+	"p2p-call/internal/rtc/turncreds"
+	"p2p-call/internal/turnserver"
+	appconfig "p2p-call/pkg/config"
 	"p2p-call/pkg/interface/desktop"
 	"p2p-call/pkg/logger"
 	"p2p-call/pkg/system"
@@ -20,10 +30,104 @@ func main() {
 	}
 	logger.InitLogger()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "turn-server":
+			runTurnServer()
+			return
+		case "nettest":
+			runNetworkTest()
+			return
+		case "echo":
+			runEcho()
+			return
+		case "devices":
+			runListDevices()
+			return
+		}
+	}
+
 	ctx := context.Background()
 
+	if addr := appconfig.GetMetricsAddr(); addr != "" {
+		go func() {
+			log.Info().Str("addr", addr).Msg("Serving metrics")
+			if err := metrics.Serve(addr); err != nil {
+				log.Error().Err(err).Msg("Metrics endpoint stopped")
+			}
+		}()
+	}
+
+	audioCfg := createAudioConfig()
+
+	// connect to audio pipeline
+	pipeline, err := pipeline.NewAudioPipeline(audioCfg, appconfig.GetAudioBackendConfig())
+	if err != nil {
+		log.Error().Msgf("Failed to create audio pipeline: %v", err)
+		system.WaitForUserResponse(true)
+	}
+	defer pipeline.Close()
+
+	if aecCfg := appconfig.GetAECConfig(); aecCfg.Enabled {
+		if err := pipeline.EnableEchoCancellation(aecCfg.Tail, aecCfg.MaxDelay); err != nil {
+			log.Warn().Err(err).Msg("Echo cancellation is off")
+		}
+	}
+	if nsCfg := appconfig.GetNoiseConfig(); nsCfg.Enabled {
+		if err := pipeline.EnableNoiseSuppression(nsCfg.Level); err != nil {
+			log.Warn().Err(err).Msg("Noise suppression is off")
+		}
+	}
+	agcCfg := appconfig.GetAGCConfig()
+	if err := pipeline.EnableGainControl(dsp.GainConfig{
+		Automatic: agcCfg.Enabled,
+		Target:    float64(agcCfg.Target),
+		MaxGain:   float64(agcCfg.MaxGain),
+		Attack:    agcCfg.Attack,
+		Release:   agcCfg.Release,
+		Manual:    float64(agcCfg.InputGain),
+	}); err != nil {
+		log.Warn().Err(err).Msg("Input gain control is off")
+	}
+	if agcCfg.OutputGain != 0 {
+		if err := pipeline.EnableOutputGain(float64(agcCfg.OutputGain)); err != nil {
+			log.Warn().Err(err).Msg("Output gain is off")
+		}
+	}
+	for _, stage := range appconfig.GetChainConfig().Bypass {
+		if err := pipeline.SetStageBypass(stage, true); err != nil {
+			log.Warn().Err(err).Msg("Can't bypass processing stage")
+		}
+	}
+
+	webRtcCon := rtc.NewConnection(pipeline)
+	defer webRtcCon.Close()
+	go webRtcCon.LogConnectionErrors(webRtcCon.ConStatusChannel)
+	// init peer connection
+	if err := webRtcCon.Connect(ctx, &audioCfg); err != nil {
+		log.Error().Msgf("Failed to start webrtc connection: %v", err)
+		system.WaitForUserResponse(true)
+	}
+
+	desktopIface, err := desktop.NewDesktopInterface(pipeline.Capture, pipeline.Playback, webRtcCon)
+	if err != nil {
+		log.Printf("Failed to create desktop interface %v", err)
+	}
+
+	desktopIface.StartDesktopInterface()
+
+}
+
+// createAudioConfig selects the codec and creates its encoder and decoder
+func createAudioConfig() config.AudioConfig {
 	// create audio codec also can be used opus
 	audioCfg := config.NewOpusConfig() // or config.NewOpusConfig()
+	dtxCfg := appconfig.GetDTXConfig()
+	audioCfg.DTX = dtxCfg.Enabled
+	audioCfg.DTXHangover = dtxCfg.Hangover
+	chainCfg := appconfig.GetChainConfig()
+	audioCfg.CaptureChain = chainCfg.Capture
+	audioCfg.PlaybackChain = chainCfg.Playback
 
 	// fabric create encoder and decoder based on build tags
 	enc, err := codec.CreateEncoder(audioCfg)
@@ -41,28 +145,80 @@ func main() {
 	audioCfg.Decoder = dec
 
 	//audioCfg := config.NewOpusConfig() // can be selected any codec here
+	return audioCfg
+}
 
-	// connect to audio pipeline
-	pipeline, err := pipeline.NewAudioPipeline(audioCfg)
-	if err != nil {
-		log.Error().Msgf("Failed to create audio pipeline: %v", err)
-		system.WaitForUserResponse(true)
-	}
-	defer pipeline.Close()
+// runEcho answers a call without sound devices and sends the caller's audio back after a delay
+func runEcho() {
+	ctx := context.Background()
+	audioCfg := createAudioConfig()
 
-	webRtcCon := rtc.NewConnection(pipeline)
-	go webRtcCon.LogConnectionErrors(webRtcCon.ConStatusChannel)
-	// init peer connection
+	echoPipeline := pipeline.NewEchoPipeline(audioCfg, appconfig.GetEchoConfig().Delay)
+	defer echoPipeline.Close()
+
+	webRtcCon := rtc.NewConnection(echoPipeline)
+	defer webRtcCon.Close()
+	go func() {
+		for err := range webRtcCon.ConStatusChannel {
+			if err != nil {
+				log.Warn().Err(err).Msg("Echo call connection changed")
+				continue
+			}
+			log.Info().Msg("Echo call connected")
+		}
+	}()
+
+	log.Info().Msg("Echo mode, waiting for a call")
 	if err := webRtcCon.Connect(ctx, &audioCfg); err != nil {
 		log.Error().Msgf("Failed to start webrtc connection: %v", err)
 		system.WaitForUserResponse(true)
+		return
 	}
 
-	desktopIface, err := desktop.NewDesktopInterface(pipeline.Capture, pipeline.Playback)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	log.Info().Msg("Echo mode stopped")
+}
+
+// runListDevices prints the sound cards that AUDIO_INPUT_DEVICE and AUDIO_OUTPUT_DEVICE can select
+func runListDevices() {
+	capture, playback, err := device.Devices()
 	if err != nil {
-		log.Printf("Failed to create desktop interface %v", err)
+		log.Error().Msgf("Failed to list audio devices: %v", err)
+		system.WaitForUserResponse(true)
+		return
 	}
+	device.Print(os.Stdout, "Capture devices", capture)
+	device.Print(os.Stdout, "Playback devices", playback)
+	println("* marks the default device")
+}
 
-	desktopIface.StartDesktopInterface()
+// runTurnServer serves STUN/TURN for other peers until interrupted
+func runTurnServer() {
+	server, err := turnserver.Start(appconfig.GetTurnServerConfig())
+	if err != nil {
+		log.Error().Msgf("Failed to start TURN server: %v", err)
+		system.WaitForUserResponse(true)
+		return
+	}
+	defer server.Close()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	log.Info().Msg("TURN server stopped")
+}
 
+// runNetworkTest checks whether calls can get through this network and prints a verdict
+func runNetworkTest() {
+	ctx := context.Background()
+	println("Testing network, this takes up to a minute...")
+
+	turnServers, _, err := turncreds.NewProvider(appconfig.GetTurnConfig()).ICEServers(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get TURN credentials")
+	}
+	report := nettest.Run(ctx, appconfig.GetStunServers(), turnServers, base.BootstrapPeers)
+	report.Print(os.Stdout)
 }
@@ -3,109 +3,326 @@ package capture
 import (
 	"fmt"
 	"log"
+	"p2p-call/internal/audio/chain"
 	"p2p-call/internal/audio/codec/iface"
 	"p2p-call/internal/audio/config"
-	"runtime"
-
-	"github.com/gen2brain/malgo"
+	"p2p-call/internal/audio/convert"
+	"p2p-call/internal/audio/dsp"
+	"p2p-call/internal/metrics"
+	"slices"
+	"sync/atomic"
+	"time"
 )
 
-type MalgoCapture struct {
-	PcmChan      chan []byte // пока временно конвертация в этом же пакете
-	ctx          *malgo.AllocatedContext
-	device       *malgo.Device
-	Paused       bool
-	capCfg       malgo.DeviceConfig
-	frameSamples int
+const chainQueue = 10 // frames waiting between processing stages
+
+// Frame is one encoded audio frame ready to be sent
+type Frame struct {
+	Data     []byte
+	Duration time.Duration // RTP time the frame takes, longer than the audio when frames before it were dropped
+	Level    uint8         // RFC 6464 level of the captured signal, -dBov
+	Silent   bool          // no voice detected for longer than the hangover, or muted
+}
+
+// stream turns PCM from any backend into encoded frames, shared by all capture backends.
+// Whole frames run through the processing chain, voice detection and encoding are stages of it.
+type stream struct {
+	PcmChan      chan Frame // пока временно конвертация в этом же пакете
+	paused       atomic.Bool
+	sampleRate   int
+	channels     int
+	frameSamples atomic.Int64
 	enc          iface.Encoder
+	chain        *chain.Chain
+	blocks       chan *chain.Block // frames entering the chain
+	vad          *dsp.VoiceDetector
+	vadOff       atomic.Bool                   // the voice detection stage is bypassed
+	talking      atomic.Bool                   // voice detected on the microphone, also while muted
+	suspended    atomic.Bool                   // call on hold, microphone audio is not sent regardless of mute
+	holdSource   atomic.Pointer[func([]int16)] // replaces microphone audio while set, e.g. hold music
+	pending      []int16                       // captured samples not filling a whole frame yet
+	pendingRate  int                           // rate of pending, the backend's
+	framed       int64                         // frames per channel at the codec rate cut from pendingRate input
+	resampler    *convert.Resampler            // used by the resample stage only
+	resampled    []int16                       // resampler output not passed on yet
+	period       atomic.Int64                  // how much audio the backend delivers at once
+	accumulation atomic.Int64                  // how long the oldest sample of the last frame waited
+	quit         chan struct{}
 }
 
-func NewMalgoCapture(audiocfg config.AudioConfig) (*MalgoCapture, error) {
-	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(msg string) {
-		log.Println("Malgo context message", msg)
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to init malgo context: %w", err)
+func newStream(audiocfg config.AudioConfig) *stream {
+	s := &stream{
+		PcmChan:    make(chan Frame, audiocfg.BufferSize),
+		sampleRate: int(audiocfg.SampleRate),
+		channels:   int(audiocfg.Channels),
+		enc:        audiocfg.Encoder,
+		blocks:     make(chan *chain.Block, chainQueue),
+		vad:        dsp.NewVoiceDetector(int(audiocfg.SampleRate), int(audiocfg.Channels), config.EnergyThreshold, audiocfg.DTXHangover),
+		quit:       make(chan struct{}),
 	}
+	s.paused.Store(true)
+	s.frameSamples.Store(int64(audiocfg.FrameSamples))
 
-	mc := &MalgoCapture{
-		PcmChan: make(chan []byte, audiocfg.BufferSize),
-		Paused:  true,
-		ctx:     ctx,
+	order := audiocfg.CaptureChain
+	if len(order) == 0 {
+		order = config.CaptureStages
 	}
-
-	capCfg := malgo.DefaultDeviceConfig(malgo.Capture)
-	capCfg.Capture.Format = malgo.FormatS16
-	capCfg.Capture.Channels = uint32(audiocfg.Channels)
-	capCfg.SampleRate = audiocfg.SampleRate
-
-	// alsa specific settings for linux
-	if runtime.GOOS == "linux" {
-		capCfg.Alsa.NoMMap = 1
+	// devices run at their own rate, the other stages need the codec rate
+	if i := slices.Index(order, config.StageResample); i != 0 {
+		if i > 0 {
+			log.Printf("Capture stages %v can't run before %q at the device rate, %q moved first", order[:i], config.StageResample, config.StageResample)
+			order = slices.Delete(slices.Clone(order), i, i+1)
+		}
+		order = append([]string{config.StageResample}, order...)
+	}
+	s.chain = chain.New("capture", order, config.CaptureStages, []string{config.StageResample, config.StageEncode})
+	s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample})
+	if err := s.chain.Register(chain.Stage{Name: config.StageVAD, Process: s.detectVoice, Bypass: s.bypassVoice}); err != nil {
+		log.Printf("No voice detection, every frame counts as speech: %v", err)
 	}
+	s.chain.Register(chain.Stage{Name: config.StageEncode, Process: s.encode})
+	go s.forward()
+	return s
+}
 
-	mc.capCfg = capCfg
-	mc.frameSamples = audiocfg.FrameSamples
-	mc.enc = audiocfg.Encoder
+// Frames returns the channel encoded frames are sent to
+func (s *stream) Frames() <-chan Frame {
+	return s.PcmChan
+}
 
-	return mc, nil
+// SetPaused mutes the input, muted frames are still sent as silence
+func (s *stream) SetPaused(paused bool) {
+	s.paused.Store(paused)
 }
 
-func (mc *MalgoCapture) StartMalgoCapture() error {
+// Paused reports whether the input is muted
+func (s *stream) Paused() bool {
+	return s.paused.Load()
+}
 
-	var capturedPCM []int16
+// write frames interleaved samples captured at rate and passes whole frames to the processing chain,
+// each as long as a codec frame. Only one goroutine of the backend may call it.
+func (s *stream) write(samples []int16, rate int) {
+	if rate != s.pendingRate {
+		s.pending, s.pendingRate, s.framed = s.pending[:0], rate, 0
+	}
+	s.pending = append(s.pending, samples...)
 
-	onCapture := func(_, input []byte, frameCount uint32) {
-		if mc.Paused {
+	for {
+		frameSamples := int(s.frameSamples.Load())
+		perChannel := int64(frameSamples / s.channels)
+		// cut on the codec frame boundaries so fractional frame lengths at rate don't add up
+		need := int((s.framed+perChannel)*int64(rate)/int64(s.sampleRate)-s.framed*int64(rate)/int64(s.sampleRate)) * s.channels
+		if len(s.pending) < need {
 			return
 		}
-		samples := make([]int16, int(frameCount*mc.capCfg.Capture.Channels))
-		for i := 0; i < len(samples); i++ {
-			off := i * 2
-			samples[i] = int16(input[off]) | int16(input[off+1])<<8
+		block := &chain.Block{
+			PCM:      slices.Clone(s.pending[:need]),
+			Rate:     rate,
+			Duration: s.samplesDuration(frameSamples),
+			Muted:    s.paused.Load() || s.suspended.Load(),
+			Voice:    true,
 		}
-		capturedPCM = append(capturedPCM, samples...)
+		s.pending = s.pending[need:]
+		s.framed += perChannel
+		waited := time.Duration(len(s.pending)/s.channels) * time.Second / time.Duration(rate)
+		s.accumulation.Store(int64(block.Duration + waited + s.chain.Delay()))
 
-		for len(capturedPCM) >= mc.frameSamples {
-			int16Sample := capturedPCM[:mc.frameSamples]
-			capturedPCM = capturedPCM[mc.frameSamples:]
-
-			pkt, err := mc.enc.Encode(int16Sample)
-			if err != nil {
-				log.Printf("encode err: %v", err)
-				continue
-			}
-			select {
-			case mc.PcmChan <- pkt:
-			default:
+		select {
+		case s.blocks <- block:
+		default:
+			s.chain.Skip(block)
+			metrics.PipelineDrop("capture")
+		}
+	}
+}
 
-			}
+// resample is the resampling stage, it converts frames to the codec rate and keeps them a codec frame long.
+// The resampler is primed with its delay of silence so the frame is always filled.
+func (s *stream) resample(b *chain.Block) bool {
+	if b.Rate == s.sampleRate {
+		if s.resampler != nil {
+			s.resampler, s.resampled = nil, nil
+			s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample})
 		}
+		return true
+	}
+	from := 0
+	if s.resampler != nil {
+		from, _ = s.resampler.Rates()
+	}
+	if from != b.Rate {
+		s.resampler = convert.NewResampler(b.Rate, s.sampleRate, s.channels)
+		primed := int(s.resampler.Delay()*time.Duration(s.sampleRate)/time.Second) + 2
+		s.resampled = make([]int16, primed*s.channels)
+		s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample, Delay: s.resampler.Delay() + s.samplesDuration(len(s.resampled))})
+		log.Printf("Resampling captured audio from %d Hz to %d Hz", b.Rate, s.sampleRate)
 	}
+	s.resampled = append(s.resampled, s.resampler.Process(b.PCM)...)
 
-	device, err := malgo.InitDevice(mc.ctx.Context, mc.capCfg, malgo.DeviceCallbacks{Data: onCapture})
-	if err != nil {
-		return fmt.Errorf("failed to open capture device: %w", err)
+	want := int(b.Duration*time.Duration(s.sampleRate)/time.Second) * s.channels
+	if len(s.resampled) < want {
+		s.resampled = append(s.resampled, make([]int16, want-len(s.resampled))...)
+	}
+	b.PCM = slices.Clone(s.resampled[:want])
+	b.Rate = s.sampleRate
+	s.resampled = append(s.resampled[:0], s.resampled[want:]...)
+	return true
+}
+
+// detectVoice is the voice detection stage. The microphone is listened to even while muted,
+// so talking while muted can be pointed out.
+func (s *stream) detectVoice(b *chain.Block) bool {
+	if s.vadOff.Load() {
+		return true
 	}
-	mc.device = device
+	b.Voice = s.vad.Detect(b.PCM)
+	s.talking.Store(b.Voice)
+	return true
+}
+
+func (s *stream) bypassVoice(bypassed bool) {
+	s.vadOff.Store(bypassed)
+	s.talking.Store(false)
+}
 
-	err = mc.device.Start()
+// encode is the encoding stage, hold music replaces the microphone here after processing
+func (s *stream) encode(b *chain.Block) bool {
+	if fill := s.holdSource.Load(); fill != nil {
+		(*fill)(b.PCM)
+		b.Muted, b.Voice = false, true // hold music is sent whole, pauses included
+	}
+	if b.Muted {
+		return true
+	}
+	pkt, err := s.enc.Encode(b.PCM)
 	if err != nil {
-		return fmt.Errorf("failed to start capture device: %w", err)
+		log.Printf("encode err: %v", err)
+		return false
 	}
+	b.Data = pkt
+	return true
+}
 
-	log.Println("Capture device started")
+// forward sends the frames leaving the chain to PcmChan. The time of frames dropped on the way
+// is added to the next frame sent so the RTP timestamp keeps up with the capture clock.
+func (s *stream) forward() {
+	var skipped time.Duration
+	for b := range s.chain.Start(s.quit, s.blocks, chainQueue) {
+		// muted frames still flow as silence so the RTP clock keeps running
+		frame := Frame{Data: b.Data, Duration: b.Duration + b.Skipped + skipped, Level: convert.MaxAudioLevel, Silent: b.Muted || !b.Voice}
+		if !b.Muted {
+			frame.Level = convert.AudioLevel(b.PCM)
+		}
+		select {
+		case s.PcmChan <- frame:
+			skipped = 0
+		default:
+			skipped = frame.Duration
+			metrics.PipelineDrop("send")
+		}
+	}
+}
 
-	return nil
+// Chain returns the processing chain captured audio runs through
+func (s *stream) Chain() *chain.Chain {
+	return s.chain
+}
+
+// Talking reports whether voice is detected on the microphone, whether muted or not
+func (s *stream) Talking() bool {
+	return s.talking.Load()
+}
+
+// Suspend stops sending microphone audio while the call is on hold, independent of mute
+func (s *stream) Suspend(suspended bool) {
+	s.suspended.Store(suspended)
+}
 
+// SetHoldSource replaces microphone audio with frames filled by source, nil switches back to the microphone
+func (s *stream) SetHoldSource(source func(samples []int16)) {
+	if source == nil {
+		s.holdSource.Store(nil)
+		return
+	}
+	s.holdSource.Store(&source)
+}
+
+// SampleRate returns the capture rate and channel count
+func (s *stream) SampleRate() (rate, channels int) {
+	return s.sampleRate, s.channels
 }
 
-func (mc *MalgoCapture) Close() {
-	if mc.device != nil {
-		mc.device.Uninit()
+// SetFrameDuration changes the length of encoded frames, takes effect from the next frame
+func (s *stream) SetFrameDuration(d time.Duration) error {
+	perChannel := int(d * time.Duration(s.sampleRate) / time.Second)
+	if !convert.IsFrameSizeValid(s.sampleRate, perChannel) {
+		return fmt.Errorf("unsupported frame duration %v at %d Hz", d, s.sampleRate)
 	}
-	if mc.ctx != nil {
-		_ = mc.ctx.Uninit()
-		mc.ctx.Free()
+	s.frameSamples.Store(int64(perChannel * s.channels))
+	return nil
+}
+
+// FrameDuration returns the current length of encoded frames
+func (s *stream) FrameDuration() time.Duration {
+	return s.samplesDuration(int(s.frameSamples.Load()))
+}
+
+// Latency returns the backend period and how long the oldest sample of the last frame
+// waited for the frame to fill, plus the delay of the processing stages
+func (s *stream) Latency() (device, accumulation time.Duration) {
+	return time.Duration(s.period.Load()), time.Duration(s.accumulation.Load())
+}
+
+// samplesDuration converts interleaved sample count to playback duration
+func (s *stream) samplesDuration(samples int) time.Duration {
+	perChannel := samples / s.channels
+	return time.Duration(perChannel) * time.Second / time.Duration(s.sampleRate)
+}
+
+// pace calls read every period with the interleaved samples due since the previous call,
+// following the wall clock so missed ticks don't slow the stream down. period is asked on every tick.
+func (s *stream) pace(period func() time.Duration, read func(samples []int16)) {
+	s.paceUntil(nil, period, read)
+}
+
+// paceUntil paces like pace until stop is closed
+func (s *stream) paceUntil(stop <-chan struct{}, period func() time.Duration, read func(samples []int16)) {
+	current := period()
+	s.period.Store(int64(current))
+	ticker := time.NewTicker(current)
+	defer ticker.Stop()
+
+	start := time.Now()
+	delivered := 0 // per channel samples since start
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			due := int(now.Sub(start)*time.Duration(s.sampleRate)/time.Second) - delivered
+			if due > 0 {
+				samples := make([]int16, due*s.channels)
+				read(samples)
+				s.write(samples, s.sampleRate)
+				delivered += due
+			}
+			if next := period(); next != current {
+				current = next
+				s.period.Store(int64(current))
+				ticker.Reset(current)
+			}
+		}
 	}
 }
+
+// every is a pace period that doesn't change
+func every(period time.Duration) func() time.Duration {
+	return func() time.Duration { return period }
+}
+
+func (s *stream) close() {
+	close(s.quit)
+}
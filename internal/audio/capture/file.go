@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/convert"
+	"p2p-call/internal/audio/wav"
+	"path/filepath"
+	"strings"
+)
+
+// sampleReader reads interleaved samples from a file, io.EOF marks the end
+type sampleReader interface {
+	Read(samples []int16) (int, error)
+	Rewind() error
+}
+
+// FileCapture streams a file in real time at the codec frame rate. WAV files (by extension) are
+// converted to the codec channel count and rate, other files are raw 16 bit little endian PCM
+// in the codec format. Silence follows the end of the file unless it loops.
+type FileCapture struct {
+	*stream
+	file         *os.File
+	source       sampleReader
+	fileChannels int
+	resampler    *convert.Resampler // nil when the file is at the codec rate
+	resampled    []int16            // converted samples left over from the previous read
+	loop         bool
+	done         bool
+}
+
+func NewFileCapture(audiocfg config.AudioConfig, path string, loop bool) (*FileCapture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+
+	fc := &FileCapture{
+		stream:       newStream(audiocfg),
+		file:         file,
+		source:       &rawReader{file: file, reader: bufio.NewReader(file)},
+		fileChannels: int(audiocfg.Channels),
+		loop:         loop,
+	}
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		reader, err := wav.NewReader(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		format := reader.Format()
+		if format.SampleRate != int(audiocfg.SampleRate) {
+			fc.resampler = convert.NewResampler(format.SampleRate, int(audiocfg.SampleRate), fc.channels)
+		}
+		fc.source = reader
+		fc.fileChannels = format.Channels
+		log.Printf("Capturing from %s (%v, %d Hz, %d channels)", path, reader.Duration(), format.SampleRate, format.Channels)
+	} else {
+		log.Printf("Capturing from %s", path)
+	}
+
+	go fc.pace(fc.FrameDuration, fc.read) // follows frame duration changes
+	return fc, nil
+}
+
+// read fills samples from the file at the codec rate
+func (fc *FileCapture) read(samples []int16) {
+	if fc.resampler == nil {
+		copy(samples, fc.readFile(len(samples)/fc.channels))
+		return
+	}
+	for len(fc.resampled) < len(samples) {
+		frames := fc.resampler.Need((len(samples) - len(fc.resampled)) / fc.channels)
+		fc.resampled = append(fc.resampled, fc.resampler.Process(fc.readFile(frames))...)
+	}
+	n := copy(samples, fc.resampled)
+	fc.resampled = append(fc.resampled[:0], fc.resampled[n:]...)
+}
+
+// readFile reads frames at the file rate in the codec channel count, rewinding at the end
+// when looping and padding with silence once the file is done
+func (fc *FileCapture) readFile(frames int) []int16 {
+	buf := make([]int16, frames*fc.fileChannels)
+	filled := 0
+	rewound := false
+	for filled < len(buf) && !fc.done {
+		n, err := fc.source.Read(buf[filled:])
+		filled += n
+		switch {
+		case err == nil:
+		case !errors.Is(err, io.EOF):
+			log.Printf("Failed to read capture file: %v", err)
+			fc.done = true
+		case !fc.loop || (rewound && n == 0): // an empty file can't loop
+			log.Println("Capture file finished")
+			fc.done = true
+		default:
+			if err := fc.source.Rewind(); err != nil {
+				log.Printf("Failed to rewind capture file: %v", err)
+				fc.done = true
+			}
+			rewound = true
+		}
+	}
+	samples := make([]int16, frames*fc.channels)
+	copy(samples, convert.Remix(buf[:filled-filled%fc.fileChannels], fc.fileChannels, fc.channels))
+	return samples
+}
+
+func (fc *FileCapture) Close() {
+	fc.close()
+	_ = fc.file.Close()
+}
+
+// rawReader reads headerless 16 bit little endian PCM
+type rawReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	odd    bool // the file ends in half a sample, reported once
+}
+
+func (r *rawReader) Read(samples []int16) (int, error) {
+	buf := make([]byte, len(samples)*2)
+	n, err := io.ReadFull(r.reader, buf)
+	for i := 0; i < n/2; i++ {
+		samples[i] = int16(binary.LittleEndian.Uint16(buf[i*2:]))
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	if n%2 != 0 && !r.odd {
+		log.Printf("Capture file %s ends in half a sample, the last byte is skipped", r.file.Name())
+		r.odd = true
+	}
+	return n / 2, err
+}
+
+func (r *rawReader) Rewind() error {
+	if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r.reader.Reset(r.file)
+	return nil
+}
@@ -0,0 +1,32 @@
+package capture
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	holdNoteDuration = 400 * time.Millisecond
+	holdAmplitude    = 0.1 * math.MaxInt16 // about -20 dBFS, quiet background
+)
+
+// holdMelody is a slow C major arpeggio, frequencies in Hz
+var holdMelody = []float64{523.25, 659.25, 783.99, 659.25}
+
+// NewHoldMusic returns a source that fills interleaved frames with a soft looping melody
+func NewHoldMusic(sampleRate, channels int) func(samples []int16) {
+	noteSamples := int(holdNoteDuration * time.Duration(sampleRate) / time.Second)
+	position := 0
+	return func(samples []int16) {
+		for i := 0; i+channels <= len(samples); i += channels {
+			note := (position / noteSamples) % len(holdMelody)
+			t := float64(position%noteSamples) / float64(sampleRate)
+			decay := math.Exp(-3 * t / holdNoteDuration.Seconds()) // plucked note fading out
+			value := int16(holdAmplitude * decay * math.Sin(2*math.Pi*holdMelody[note]*t))
+			for c := 0; c < channels; c++ {
+				samples[i+c] = value
+			}
+			position++
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package capture
+
+import (
+	"fmt"
+	"log"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/device"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gen2brain/malgo"
+)
+
+// watchInterval is how often the device list is checked for unplugged, returning and new default devices
+const watchInterval = 2 * time.Second
+
+// MalgoCapture records from a sound card, the default one unless a device was selected
+type MalgoCapture struct {
+	*stream
+	ctx      *malgo.AllocatedContext
+	mu       sync.Mutex // guards the fields below while switching
+	device   *malgo.Device
+	active   device.Info // device is opened on, zero while none is open
+	capCfg   malgo.DeviceConfig
+	selector string // device requested by id or name, empty for the default
+	fallback string // device tried before the default when the selected one goes away
+	lost     string // device that went away while no other one could be opened
+	onChange func(device.Change)
+	gap      chan struct{} // closed to stop the silence sent while no device is open
+	gapDone  chan struct{}
+	closed   bool
+}
+
+// NewMalgoCapture prepares capture from the device selected by id or name part, empty selects the default.
+// When the device goes away capture moves to fallback, then to the default device.
+func NewMalgoCapture(audiocfg config.AudioConfig, selector, fallback string) (*MalgoCapture, error) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(msg string) {
+		log.Println("Malgo context message", msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init malgo context: %w", err)
+	}
+
+	mc := &MalgoCapture{
+		stream:   newStream(audiocfg),
+		ctx:      ctx,
+		selector: selector,
+		fallback: fallback,
+	}
+
+	// the device runs at its native rate, the resample stage converts to the codec rate
+	capCfg := malgo.DefaultDeviceConfig(malgo.Capture)
+	capCfg.Capture.Format = malgo.FormatS16
+	capCfg.Capture.Channels = uint32(audiocfg.Channels)
+	capCfg.SampleRate = 0
+
+	// alsa specific settings for linux
+	if runtime.GOOS == "linux" {
+		capCfg.Alsa.NoMMap = 1
+	}
+
+	mc.capCfg = capCfg
+
+	return mc, nil
+}
+
+func (mc *MalgoCapture) StartMalgoCapture() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if err := mc.replace(mc.selector); err != nil {
+		return err
+	}
+	go mc.watch()
+
+	log.Printf("Capture device %q started", mc.active.Name)
+
+	return nil
+
+}
+
+// SwitchDevice moves capture to another device without interrupting the frame stream,
+// the current device keeps running if the new one can't be opened
+func (mc *MalgoCapture) SwitchDevice(selector string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if err := mc.replace(selector); err != nil {
+		return err
+	}
+	mc.selector = selector
+	mc.lost = ""
+	log.Printf("Capture device switched to %q", mc.active.Name)
+	return nil
+}
+
+// OnDeviceChange sets the handler called when the device goes away and capture moves to another one
+func (mc *MalgoCapture) OnDeviceChange(handler func(device.Change)) {
+	mc.mu.Lock()
+	mc.onChange = handler
+	mc.mu.Unlock()
+}
+
+// replace opens the selected device and moves capture to it, the caller holds mu.
+// The current device keeps running if the new one can't be opened.
+func (mc *MalgoCapture) replace(selector string) error {
+	next, info, err := mc.openDevice(selector)
+	if err != nil {
+		return err
+	}
+	// only one writer may feed the stream, so the old device or the silence stops first
+	filling := mc.gap != nil
+	if mc.device != nil {
+		_ = mc.device.Stop()
+	}
+	mc.endGap()
+	if err := next.Start(); err != nil {
+		next.Uninit()
+		if mc.device != nil {
+			_ = mc.device.Start()
+		} else if filling {
+			mc.fillGap()
+		}
+		return fmt.Errorf("failed to start capture device: %w", err)
+	}
+	if mc.device != nil {
+		mc.device.Uninit()
+	}
+	mc.device = next
+	mc.active = info
+	return nil
+}
+
+// openDevice initialises the selected device, the caller holds mu
+func (mc *MalgoCapture) openDevice(selector string) (*malgo.Device, device.Info, error) {
+	info, err := device.Find(mc.ctx.Context, malgo.Capture, selector)
+	if err != nil {
+		return nil, device.Info{}, err
+	}
+	capCfg := mc.capCfg
+	// the default is opened without an id so backends that follow default changes can do so
+	if selector != "" {
+		capCfg.Capture.DeviceID = info.Pointer()
+	}
+
+	// the callback only copies the samples out, the resample stage converts them to the codec rate
+	var rate int // set before the device starts, the native rate is known then
+	onCapture := func(_, input []byte, frameCount uint32) {
+		samples := make([]int16, int(frameCount*capCfg.Capture.Channels))
+		for i := 0; i < len(samples); i++ {
+			off := i * 2
+			samples[i] = int16(input[off]) | int16(input[off+1])<<8
+		}
+		mc.period.Store(int64(time.Duration(frameCount) * time.Second / time.Duration(rate)))
+		mc.write(samples, rate)
+	}
+
+	var dev *malgo.Device
+	// called on the audio thread, which uninit waits for
+	onStop := func() {
+		go mc.deviceStopped(dev)
+	}
+
+	dev, err = malgo.InitDevice(mc.ctx.Context, capCfg, malgo.DeviceCallbacks{Data: onCapture, Stop: onStop})
+	if err != nil {
+		return nil, device.Info{}, fmt.Errorf("failed to open capture device: %w", err)
+	}
+	rate = int(dev.SampleRate())
+	log.Printf("Capture device %q runs at %d Hz", info.Name, dev.SampleRate())
+	return dev, info, nil
+}
+
+// deviceStopped moves capture elsewhere when the device stopped by itself, e.g. it was unplugged
+func (mc *MalgoCapture) deviceStopped(dev *malgo.Device) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	// switching and closing stop devices on purpose
+	if mc.closed || mc.device != dev || dev.IsStarted() {
+		return
+	}
+	mc.lose()
+}
+
+// lose drops the device that went away and moves to the next candidate, the caller holds mu
+func (mc *MalgoCapture) lose() {
+	lost := mc.active.Name
+	log.Printf("Capture device %q went away", lost)
+	mc.device.Uninit()
+	mc.device = nil
+	mc.active = device.Info{}
+	mc.fillGap()
+	mc.reopen(lost, true)
+}
+
+// reopen opens the first candidate device that works, the caller holds mu.
+// A failure is reported once, the watcher keeps retrying silently.
+func (mc *MalgoCapture) reopen(lost string, report bool) {
+	var err error
+	for _, selector := range device.Candidates(mc.selector, mc.fallback) {
+		if err = mc.replace(selector); err == nil {
+			log.Printf("Capture moved to %q", mc.active.Name)
+			mc.lost = ""
+			mc.notify(device.Change{Kind: malgo.Capture, Lost: lost, Now: mc.active.Name})
+			return
+		}
+	}
+	mc.lost = lost
+	if report {
+		log.Printf("No capture device available: %v", err)
+		mc.notify(device.Change{Kind: malgo.Capture, Lost: lost, Err: err})
+	}
+}
+
+// watch retries while no device is open, notices devices removed without a stop,
+// returns to the selected device when it is plugged back and follows the default device
+func (mc *MalgoCapture) watch() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mc.quit:
+			return
+		case <-ticker.C:
+		}
+
+		mc.mu.Lock()
+		if !mc.closed {
+			mc.check()
+		}
+		mc.mu.Unlock()
+	}
+}
+
+// check compares the open device with the device list, the caller holds mu
+func (mc *MalgoCapture) check() {
+	if mc.device == nil {
+		mc.reopen(mc.lost, false)
+		return
+	}
+	if mc.active.ID == "" {
+		return // the backend can't list devices, nothing to compare with
+	}
+	devices, err := device.Scan(mc.ctx.Context, malgo.Capture)
+	if err != nil {
+		return
+	}
+	if !device.Present(devices, mc.active.ID) {
+		mc.lose()
+		return
+	}
+	want, err := device.Select(devices, mc.selector)
+	if err != nil || want.ID == mc.active.ID {
+		return
+	}
+
+	previous := mc.active.Name
+	if err := mc.replace(mc.selector); err != nil {
+		log.Printf("Failed to move capture to %q: %v", want.Name, err)
+		return
+	}
+	log.Printf("Capture moved to %q", mc.active.Name)
+	mc.notify(device.Change{Kind: malgo.Capture, Lost: previous, Now: mc.active.Name})
+}
+
+// fillGap sends silence while no device is open so the peer keeps receiving frames, the caller holds mu
+func (mc *MalgoCapture) fillGap() {
+	if mc.gap != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	mc.gap, mc.gapDone = stop, done
+	go func() {
+		defer close(done)
+		mc.paceUntil(stop, every(paceInterval), func([]int16) {})
+	}()
+}
+
+// endGap stops the silence and waits for it, the caller holds mu
+func (mc *MalgoCapture) endGap() {
+	if mc.gap == nil {
+		return
+	}
+	close(mc.gap)
+	<-mc.gapDone
+	mc.gap, mc.gapDone = nil, nil
+}
+
+func (mc *MalgoCapture) notify(change device.Change) {
+	if mc.onChange != nil {
+		go mc.onChange(change)
+	}
+}
+
+func (mc *MalgoCapture) Close() {
+	mc.close()
+	mc.mu.Lock()
+	mc.closed = true
+	mc.endGap()
+	if mc.device != nil {
+		mc.device.Uninit()
+	}
+	mc.mu.Unlock()
+	if mc.ctx != nil {
+		_ = mc.ctx.Uninit()
+		mc.ctx.Free()
+	}
+}
@@ -0,0 +1,21 @@
+package capture
+
+import "p2p-call/internal/audio/config"
+
+// MemoryCapture encodes audio handed to Write, at whatever pace the caller writes it
+type MemoryCapture struct {
+	*stream
+}
+
+func NewMemoryCapture(audiocfg config.AudioConfig) *MemoryCapture {
+	return &MemoryCapture{stream: newStream(audiocfg)}
+}
+
+// Write captures interleaved samples, not safe for concurrent use
+func (mc *MemoryCapture) Write(samples []int16) {
+	mc.write(samples, mc.sampleRate)
+}
+
+func (mc *MemoryCapture) Close() {
+	mc.close()
+}
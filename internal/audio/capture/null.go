@@ -0,0 +1,26 @@
+package capture
+
+import (
+	"log"
+	"p2p-call/internal/audio/config"
+	"time"
+)
+
+// paceInterval is how often paced backends deliver audio, like a sound card period
+const paceInterval = 10 * time.Millisecond
+
+// NullCapture sends silence in real time, for machines without a microphone
+type NullCapture struct {
+	*stream
+}
+
+func NewNullCapture(audiocfg config.AudioConfig) *NullCapture {
+	nc := &NullCapture{stream: newStream(audiocfg)}
+	go nc.pace(every(paceInterval), func([]int16) {})
+	log.Println("Null capture started")
+	return nc
+}
+
+func (nc *NullCapture) Close() {
+	nc.close()
+}
@@ -0,0 +1,210 @@
+package chain
+
+import (
+	"fmt"
+	"log"
+	"p2p-call/internal/metrics"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Block is one frame of audio passed along a chain
+type Block struct {
+	PCM      []int16 // interleaved samples
+	Rate     int     // samples per second and channel of PCM
+	Data     []byte  // encoded audio
+	Duration time.Duration
+	Skipped  time.Duration // audio dropped before this block, its time still has to pass
+	Muted    bool          // captured while muted or on hold, not to be sent
+	Voice    bool          // voice detected, stays set unless a detector runs
+}
+
+// Stage is one named processing step
+type Stage struct {
+	Name    string
+	Process func(b *Block) bool // changes the block in place, false drops it
+	Bypass  func(bypassed bool) // optional, the stage then keeps running and passes audio through itself
+	Delay   time.Duration       // how much the stage delays the audio
+}
+
+// StageStats describes one stage of a chain
+type StageStats struct {
+	Name       string
+	Registered bool // a stage was registered, otherwise the slot passes audio through
+	Bypassed   bool
+	Blocks     uint64
+	Dropped    uint64        // refused by the stage or lost because the next one was full
+	Time       time.Duration // average processing time per block
+	Delay      time.Duration
+}
+
+// Chain runs blocks through stages in the configured order, each stage in its own goroutine.
+// Slots are fixed when the chain is created, stages can be registered into them while it runs.
+// The time of dropped blocks is carried by the next block a stage processes, so a clock
+// following the blocks leaving the chain, e.g. the RTP timestamp, doesn't fall behind.
+type Chain struct {
+	direction string
+	slots     []*slot
+	required  []string
+	skipped   atomic.Int64 // time of dropped blocks no block carries yet
+}
+
+type slot struct {
+	name     string
+	skipped  *atomic.Int64 // the chain's
+	stage    atomic.Pointer[Stage]
+	bypassed atomic.Bool
+	blocks   atomic.Uint64
+	dropped  atomic.Uint64
+	busy     atomic.Int64 // total processing time
+}
+
+// New creates a chain running the stages named in order. Names not in known are ignored,
+// required stages missing from order are added at the end.
+func New(direction string, order, known, required []string) *Chain {
+	c := &Chain{direction: direction, required: required}
+	for _, name := range order {
+		switch {
+		case !slices.Contains(known, name):
+			log.Printf("Unknown %s stage %q ignored, known stages: %v", direction, name, known)
+		case c.slot(name) != nil:
+			log.Printf("The %s stage %q is listed twice, the first one is used", direction, name)
+		default:
+			c.slots = append(c.slots, &slot{name: name, skipped: &c.skipped})
+		}
+	}
+	for _, name := range required {
+		if c.slot(name) == nil {
+			log.Printf("The %s chain needs %q, added at the end", direction, name)
+			c.slots = append(c.slots, &slot{name: name, skipped: &c.skipped})
+		}
+	}
+	return c
+}
+
+// Register puts stage into its slot, replacing the stage registered before.
+// Fails when the stage is not part of the chain.
+func (c *Chain) Register(stage Stage) error {
+	s := c.slot(stage.Name)
+	if s == nil {
+		return fmt.Errorf("stage %q is not in the %s chain", stage.Name, c.direction)
+	}
+	if stage.Bypass != nil {
+		stage.Bypass(s.bypassed.Load())
+	}
+	s.stage.Store(&stage)
+	return nil
+}
+
+// SetBypass passes audio around the named stage, or through it again
+func (c *Chain) SetBypass(name string, bypassed bool) error {
+	s := c.slot(name)
+	if s == nil {
+		return fmt.Errorf("stage %q is not in the %s chain", name, c.direction)
+	}
+	if slices.Contains(c.required, name) {
+		return fmt.Errorf("the %s stage %q can't be bypassed", c.direction, name)
+	}
+	s.bypassed.Store(bypassed)
+	if stage := s.stage.Load(); stage != nil && stage.Bypass != nil {
+		stage.Bypass(bypassed)
+	}
+	return nil
+}
+
+// Has reports whether the named stage is part of the chain
+func (c *Chain) Has(name string) bool {
+	return c.slot(name) != nil
+}
+
+// Bypassed reports whether audio goes around the named stage, registered is false when no stage fills its slot
+func (c *Chain) Bypassed(name string) (bypassed, registered bool) {
+	s := c.slot(name)
+	if s == nil {
+		return false, false
+	}
+	return s.bypassed.Load(), s.stage.Load() != nil
+}
+
+// Stats returns the state of every stage in order
+func (c *Chain) Stats() []StageStats {
+	stats := make([]StageStats, len(c.slots))
+	for i, s := range c.slots {
+		st := StageStats{
+			Name:     s.name,
+			Bypassed: s.bypassed.Load(),
+			Blocks:   s.blocks.Load(),
+			Dropped:  s.dropped.Load(),
+		}
+		if st.Blocks > 0 {
+			st.Time = time.Duration(s.busy.Load() / int64(st.Blocks))
+		}
+		if stage := s.stage.Load(); stage != nil {
+			st.Registered = true
+			st.Delay = stage.Delay
+		}
+		stats[i] = st
+	}
+	return stats
+}
+
+// Delay is how much the stages that are not bypassed delay the audio together
+func (c *Chain) Delay() time.Duration {
+	var delay time.Duration
+	for _, s := range c.slots {
+		if stage := s.stage.Load(); stage != nil && !s.bypassed.Load() {
+			delay += stage.Delay
+		}
+	}
+	return delay
+}
+
+// Skip records a block dropped before it entered the chain, the next block carries its time
+func (c *Chain) Skip(b *Block) {
+	c.skipped.Add(int64(b.Duration + b.Skipped))
+}
+
+// Start runs the chain on the blocks received from in until q is closed, buffer is the queue
+// length between stages. Blocks that left the last stage are sent to the returned channel.
+func (c *Chain) Start(q <-chan struct{}, in <-chan *Block, buffer int) <-chan *Block {
+	out := in
+	for _, s := range c.slots {
+		out = AddOnPipe(q, s.process, out, buffer, s.drop)
+	}
+	return out
+}
+
+func (c *Chain) slot(name string) *slot {
+	for _, s := range c.slots {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// process runs the registered stage on b, an empty or bypassed slot passes it on
+func (s *slot) process(b *Block) (*Block, bool) {
+	b.Skipped += time.Duration(s.skipped.Swap(0))
+	stage := s.stage.Load()
+	if stage == nil || (s.bypassed.Load() && stage.Bypass == nil) {
+		return b, true
+	}
+	start := time.Now()
+	keep := stage.Process(b)
+	elapsed := time.Since(start)
+	s.blocks.Add(1)
+	s.busy.Add(int64(elapsed))
+	metrics.ObserveStage(s.name, elapsed)
+	if !keep {
+		s.drop(b)
+	}
+	return b, keep
+}
+
+func (s *slot) drop(b *Block) {
+	s.dropped.Add(1)
+	s.skipped.Add(int64(b.Duration + b.Skipped))
+	metrics.PipelineDrop(s.name)
+}
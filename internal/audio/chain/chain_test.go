@@ -0,0 +1,170 @@
+package chain
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// tag is a stage that appends its name to the block data
+func tag(name string) Stage {
+	return Stage{Name: name, Process: func(b *Block) bool {
+		b.Data = append(b.Data, name...)
+		return true
+	}}
+}
+
+// run sends one block through c and returns it
+func run(t *testing.T, c *Chain) *Block {
+	t.Helper()
+	q := make(chan struct{})
+	defer close(q)
+	in := make(chan *Block, 1)
+	out := c.Start(q, in, 1)
+	in <- &Block{}
+	select {
+	case b := <-out:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("block never left the chain")
+		return nil
+	}
+}
+
+func TestChainRunsStagesInConfiguredOrder(t *testing.T) {
+	c := New("test", []string{"c", "a", "x", "a"}, []string{"a", "b", "c"}, []string{"b"})
+	for _, name := range []string{"a", "b", "c"} {
+		if err := c.Register(tag(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := string(run(t, c).Data); got != "cab" {
+		t.Errorf("stages ran as %q, want %q: unknown and repeated names skipped, required added last", got, "cab")
+	}
+	if err := c.Register(tag("x")); err == nil {
+		t.Error("stage outside the chain registered")
+	}
+}
+
+func TestChainBypass(t *testing.T) {
+	c := New("test", []string{"a", "b", "c"}, []string{"a", "b", "c"}, []string{"c"})
+	var hooked []bool
+	b := tag("b")
+	b.Bypass = func(bypassed bool) { hooked = append(hooked, bypassed) }
+	c.Register(tag("a"))
+	c.Register(b)
+	c.Register(tag("c"))
+
+	if err := c.SetBypass("a", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetBypass("b", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetBypass("c", true); err == nil {
+		t.Error("required stage bypassed")
+	}
+	// a is skipped, b bypasses itself and keeps running
+	if got := string(run(t, c).Data); got != "bc" {
+		t.Errorf("stages ran as %q, want %q", got, "bc")
+	}
+	if !slices.Equal(hooked, []bool{false, true}) {
+		t.Errorf("bypass hook called with %v, want [false true]", hooked)
+	}
+	if bypassed, registered := c.Bypassed("a"); !bypassed || !registered {
+		t.Errorf("a bypassed %t registered %t, want both", bypassed, registered)
+	}
+}
+
+func TestChainCountsBlocksAndDrops(t *testing.T) {
+	c := New("test", []string{"a", "b"}, []string{"a", "b"}, nil)
+	odd := false
+	c.Register(Stage{Name: "a", Delay: 5 * time.Millisecond, Process: func(b *Block) bool {
+		odd = !odd
+		return odd // refuses every second block
+	}})
+
+	q := make(chan struct{})
+	defer close(q)
+	in := make(chan *Block, 10)
+	out := c.Start(q, in, 10)
+	for range 10 {
+		in <- &Block{}
+	}
+	for range 5 {
+		select {
+		case <-out:
+		case <-time.After(time.Second):
+			t.Fatal("block never left the chain")
+		}
+	}
+
+	stats := c.Stats()
+	if a := stats[0]; a.Blocks != 10 || a.Dropped != 5 || a.Delay != 5*time.Millisecond {
+		t.Errorf("a processed %d blocks, dropped %d, delay %v; want 10, 5, 5ms", a.Blocks, a.Dropped, a.Delay)
+	}
+	if b := stats[1]; b.Registered || b.Blocks != 0 || b.Dropped != 0 {
+		t.Errorf("empty slot b registered %t, processed %d, dropped %d; want nothing", b.Registered, b.Blocks, b.Dropped)
+	}
+	if d := c.Delay(); d != 5*time.Millisecond {
+		t.Errorf("chain delay %v, want 5ms", d)
+	}
+	c.SetBypass("a", true)
+	if d := c.Delay(); d != 0 {
+		t.Errorf("chain delay %v with a bypassed, want 0", d)
+	}
+}
+
+func TestChainDropsWhenFull(t *testing.T) {
+	c := New("test", []string{"a"}, []string{"a"}, nil)
+	c.Register(tag("a"))
+
+	q := make(chan struct{})
+	defer close(q)
+	in := make(chan *Block, 3)
+	out := c.Start(q, in, 1)
+	for range 3 {
+		in <- &Block{}
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.Stats()[0].Blocks < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // the last block is counted before it is dropped
+
+	if a := c.Stats()[0]; a.Blocks != 3 || a.Dropped != 2 || len(out) != 1 {
+		t.Errorf("processed %d, dropped %d, queued %d; want 3, 2, 1", a.Blocks, a.Dropped, len(out))
+	}
+}
+
+func TestChainCarriesDroppedTime(t *testing.T) {
+	c := New("test", []string{"a", "b"}, []string{"a", "b"}, nil)
+	odd := false
+	c.Register(Stage{Name: "b", Process: func(b *Block) bool {
+		odd = !odd
+		return odd // refuses every second block
+	}})
+
+	q := make(chan struct{})
+	defer close(q)
+	in := make(chan *Block, 10)
+	out := c.Start(q, in, 10)
+
+	// one block never gets in, the refused ones drop inside
+	c.Skip(&Block{Duration: 20 * time.Millisecond})
+	for range 9 {
+		in <- &Block{Duration: 20 * time.Millisecond}
+	}
+	var total time.Duration
+	for range 5 {
+		select {
+		case b := <-out:
+			total += b.Duration + b.Skipped
+		case <-time.After(time.Second):
+			t.Fatal("block never left the chain")
+		}
+	}
+	if total != 200*time.Millisecond {
+		t.Errorf("blocks left the chain covering %v, want all 200ms that went in", total)
+	}
+}
@@ -0,0 +1,41 @@
+package chain
+
+import "log"
+
+// AddOnPipe adds a processing function to the pipeline.
+// q - quit channel to stop the processing
+// f - processing function, returning false drops the result
+// in - input channel
+// chanBuffer - buffer size for the output channel
+// dropped - called with every result dropped because the output channel is full, may be nil
+// returns output channel (можно добвалять доп обработку по кодированию напрмиер)
+func AddOnPipe[X, Y any](q <-chan struct{}, f func(X) (Y, bool), in <-chan X, chanBuffer int, dropped func(Y)) chan Y {
+	out := make(chan Y, chanBuffer)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-q:
+				return
+			case data, ok := <-in:
+				if !ok {
+					return
+				}
+				result, keep := f(data)
+				if !keep {
+					continue
+				}
+				select {
+				case out <- result:
+				default: // if out channel is full, drop the data
+					log.Println("Dropping data in pipeline stage")
+					if dropped != nil {
+						dropped(result)
+					}
+				}
+			}
+		}
+
+	}()
+	return out
+}
@@ -7,3 +7,10 @@ type Encoder interface {
 type Decoder interface {
 	Decode(encoded []byte) ([]int16, error)
 }
+
+// Tunable is implemented by encoders that can adapt their output to network conditions at runtime
+type Tunable interface {
+	SetBitrate(bitrate int) error
+	SetInBandFEC(enabled bool) error
+	SetPacketLossPerc(lossPerc int) error
+}
@@ -6,6 +6,9 @@ import (
 	"gopkg.in/hraban/opus.v2"
 )
 
+// maxFrameMs is the longest opus packet duration, frames up to it can arrive when the sender adapts
+const maxFrameMs = 120
+
 type OpusDecoder struct {
 	dec        *opus.Decoder
 	sampleRate int
@@ -26,7 +29,7 @@ func NewOpusDecoder(sampleRate, channels int) (*OpusDecoder, error) {
 		dec:        dec,
 		sampleRate: sampleRate,
 		channels:   channels,
-		frameSize:  config.FrameSamplesOpus * channels,
+		frameSize:  sampleRate / 1000 * maxFrameMs,
 	}, nil
 }
 
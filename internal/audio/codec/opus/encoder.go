@@ -3,6 +3,7 @@ package opus
 import (
 	"fmt"
 	"p2p-call/internal/audio/config"
+	"sync"
 
 	"gopkg.in/hraban/opus.v2"
 )
@@ -10,6 +11,7 @@ import (
 // Допустимые frame sizes для 48kHz (мс): 2.5ms=120, 5ms=240, 10ms=480, 20ms=960, 40ms=1920, 60ms=2880
 
 type OpusEncoder struct {
+	mu         sync.Mutex // encoder ctl calls come from the bitrate controller while capture encodes
 	enc        *opus.Encoder
 	sampleRate int
 	channels   int
@@ -44,7 +46,9 @@ func NewOpusEncoder(sampleRate, channels int) (*OpusEncoder, error) {
 func (e *OpusEncoder) Encode(samples []int16) ([]byte, error) {
 
 	opusData := make([]byte, 4000) // max opus packet size
+	e.mu.Lock()
 	n, err := e.enc.Encode(samples, opusData)
+	e.mu.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -59,3 +63,24 @@ func (e *OpusEncoder) Encode(samples []int16) ([]byte, error) {
 
 	return packet, nil
 }
+
+// SetBitrate sets the target bitrate in bits per second
+func (e *OpusEncoder) SetBitrate(bitrate int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.SetBitrate(bitrate)
+}
+
+// SetInBandFEC enables or disables in-band forward error correction
+func (e *OpusEncoder) SetInBandFEC(enabled bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.SetInBandFEC(enabled)
+}
+
+// SetPacketLossPerc tells the encoder the expected packet loss, used to size FEC data
+func (e *OpusEncoder) SetPacketLossPerc(lossPerc int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.SetPacketLossPerc(lossPerc)
+}
@@ -0,0 +1,125 @@
+package red
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RFC 2198 redundant audio payload.
+// Every block except the last has a 4 byte header: F=1 | PT(7) | timestamp offset(14) | length(10),
+// the primary block has a single byte header: F=0 | PT(7). Block data follows in header order.
+
+const (
+	maxTimestampOffset = 1<<14 - 1
+	maxBlockLength     = 1<<10 - 1
+	MaxDistance        = 2 // redundant frames carried per packet
+)
+
+var ErrShortPayload = errors.New("red payload too short")
+
+// Block is one frame carried inside a RED payload
+type Block struct {
+	PayloadType     uint8
+	TimestampOffset uint32 // how far before the packet timestamp the block starts, 0 for primary
+	Data            []byte
+}
+
+type historyEntry struct {
+	clock uint32
+	data  []byte
+}
+
+// Encoder wraps primary frames together with copies of the previous ones
+type Encoder struct {
+	clock   uint32 // running RTP clock of the wrapped stream
+	history []historyEntry
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Encode wraps primary with up to distance previous frames.
+// payloadType is the negotiated type of the primary codec, samples is the frame duration in clock units.
+func (e *Encoder) Encode(payloadType uint8, primary []byte, samples uint32, distance int) []byte {
+	distance = min(distance, MaxDistance)
+
+	var redundant []historyEntry
+	for i := max(len(e.history)-distance, 0); i < len(e.history); i++ {
+		entry := e.history[i]
+		if len(entry.data) == 0 || len(entry.data) > maxBlockLength || e.clock-entry.clock > maxTimestampOffset {
+			continue
+		}
+		redundant = append(redundant, entry)
+	}
+
+	size := 1 + len(primary)
+	for _, entry := range redundant {
+		size += 4 + len(entry.data)
+	}
+
+	payload := make([]byte, 0, size)
+	for _, entry := range redundant {
+		offset := e.clock - entry.clock
+		length := uint32(len(entry.data))
+		payload = append(payload,
+			0x80|payloadType&0x7f,
+			byte(offset>>6),
+			byte(offset<<2)|byte(length>>8)&0x03,
+			byte(length),
+		)
+	}
+	payload = append(payload, payloadType&0x7f)
+	for _, entry := range redundant {
+		payload = append(payload, entry.data...)
+	}
+	payload = append(payload, primary...)
+
+	e.Push(primary, samples)
+	return payload
+}
+
+// Push records a frame sent without redundancy so it can be repeated later
+func (e *Encoder) Push(primary []byte, samples uint32) {
+	e.history = append(e.history, historyEntry{clock: e.clock, data: primary})
+	if len(e.history) > MaxDistance {
+		e.history = e.history[len(e.history)-MaxDistance:]
+	}
+	e.clock += samples
+}
+
+// Decode splits a RED payload into blocks, oldest first and primary last
+func Decode(payload []byte) ([]Block, error) {
+	var blocks []Block
+	var lengths []int
+	pos := 0
+	for {
+		if pos >= len(payload) {
+			return nil, ErrShortPayload
+		}
+		if payload[pos]&0x80 == 0 {
+			blocks = append(blocks, Block{PayloadType: payload[pos] & 0x7f})
+			pos++
+			break
+		}
+		if pos+4 > len(payload) {
+			return nil, ErrShortPayload
+		}
+		blocks = append(blocks, Block{
+			PayloadType:     payload[pos] & 0x7f,
+			TimestampOffset: uint32(payload[pos+1])<<6 | uint32(payload[pos+2])>>2,
+		})
+		lengths = append(lengths, int(payload[pos+2]&0x03)<<8|int(payload[pos+3]))
+		pos += 4
+	}
+
+	for i, length := range lengths {
+		if pos+length > len(payload) {
+			return nil, fmt.Errorf("red block %d exceeds payload: %w", i, ErrShortPayload)
+		}
+		blocks[i].Data = payload[pos : pos+length]
+		pos += length
+	}
+	blocks[len(blocks)-1].Data = payload[pos:]
+	return blocks, nil
+}
@@ -0,0 +1,60 @@
+package red
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	enc := NewEncoder()
+	frames := [][]byte{{1, 2, 3}, {4, 5}, {6, 7, 8, 9}}
+
+	var payload []byte
+	for _, frame := range frames {
+		payload = enc.Encode(111, frame, 960, 2)
+	}
+
+	blocks, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(blocks))
+	}
+
+	wantOffsets := []uint32{1920, 960, 0}
+	for i, block := range blocks {
+		if block.PayloadType != 111 {
+			t.Errorf("block %d: payload type %d, want 111", i, block.PayloadType)
+		}
+		if block.TimestampOffset != wantOffsets[i] {
+			t.Errorf("block %d: offset %d, want %d", i, block.TimestampOffset, wantOffsets[i])
+		}
+		if !bytes.Equal(block.Data, frames[i]) {
+			t.Errorf("block %d: data %v, want %v", i, block.Data, frames[i])
+		}
+	}
+}
+
+func TestEncodeSkipsEmptyHistory(t *testing.T) {
+	enc := NewEncoder()
+	enc.Push(nil, 960) // silent frame
+	payload := enc.Encode(111, []byte{1}, 960, 1)
+
+	blocks, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected only the primary block, got %d", len(blocks))
+	}
+}
+
+func TestDecodeRejectsTruncated(t *testing.T) {
+	if _, err := Decode([]byte{0x80 | 111, 0, 4}); err == nil {
+		t.Error("expected error on truncated header")
+	}
+	if _, err := Decode([]byte{0x80 | 111, 0, 4, 10, 111, 1}); err == nil {
+		t.Error("expected error on block longer than payload")
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"p2p-call/internal/audio/codec/iface"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 )
@@ -31,25 +32,55 @@ const (
 	ChannelsPCM     = 1
 
 	JitterBufferSize = 2   // frames to buffer
-	EnergyThreshold  = 500 // RMS energy threshold for silence detection
+	EnergyThreshold  = 500 // RMS above which the voice detector counts audio as loud
+	DTXHangover      = 200 * time.Millisecond
 
 	AudioCodecOpus AudioConfigType = "opus"
 	AudioCodecPCMU AudioConfigType = "pcmu"
+
+	MimeTypeRED    = "audio/red" // redundant audio, RFC 2198
+	PayloadTypeRED = 63
+
+	PayloadTypeTelephoneEvent = 101 // DTMF, RFC 4733
+
+	MimeTypeCN    = "audio/CN" // comfort noise, RFC 3389
+	PayloadTypeCN = 13
 )
 
 type AudioConfig struct {
-	SampleRate   uint32
-	FrameSamples int
-	Channels     uint16
-	BufferSize   int // channel buffer size in frames
-	Type         AudioConfigType
-	SDPFmtpLine  string
-	PayloadType  uint8
-	MimeType     string
-	Encoder      iface.Encoder
-	Decoder      iface.Decoder
+	SampleRate    uint32
+	FrameSamples  int
+	Channels      uint16
+	BufferSize    int // channel buffer size in frames
+	Type          AudioConfigType
+	SDPFmtpLine   string
+	PayloadType   uint8
+	MimeType      string
+	Encoder       iface.Encoder
+	Decoder       iface.Decoder
+	DTX           bool          // suppress silent frames, PCMU sends comfort noise packets instead
+	DTXHangover   time.Duration // silence needed before frames are suppressed
+	CaptureChain  []string      // processing stages of captured audio in order, empty for CaptureStages
+	PlaybackChain []string      // processing stages of received audio in order, empty for PlaybackStages
 }
 
+// processing stages of both directions
+const (
+	StageResample = "resample" // between the device and the codec rate, required
+	StageAEC      = "aec"      // echo cancellation
+	StageNS       = "ns"       // noise suppression
+	StageAGC      = "agc"      // automatic or manual input gain
+	StageVAD      = "vad"      // voice detection, drives DTX
+	StageEncode   = "encode"   // required
+	StageDecode   = "decode"   // required
+	StageGain     = "gain"     // output gain
+)
+
+var (
+	CaptureStages  = []string{StageResample, StageAEC, StageNS, StageAGC, StageVAD, StageEncode} // known capture stages in the default order
+	PlaybackStages = []string{StageDecode, StageResample, StageGain}                             // known playback stages in the default order
+)
+
 // NewOpusConfig creates AudioConfig for Opus codec
 func NewOpusConfig() AudioConfig {
 	log.Println("Using Opus config (48kHz, high quality)")
@@ -62,6 +93,8 @@ func NewOpusConfig() AudioConfig {
 		SDPFmtpLine:  "minptime=10;useinbandfec=1;maxaveragebitrate=64000;stereo=0;sprop-stereo=0;cbr=0",
 		PayloadType:  111,
 		MimeType:     webrtc.MimeTypeOpus,
+		DTX:          true,
+		DTXHangover:  DTXHangover,
 	}
 }
 
@@ -78,6 +111,8 @@ func NewPCMUConfig() AudioConfig {
 		SDPFmtpLine:  "",
 		PayloadType:  0,
 		MimeType:     webrtc.MimeTypePCMU,
+		DTX:          true,
+		DTXHangover:  DTXHangover,
 	}
 }
 
@@ -0,0 +1,31 @@
+package convert
+
+// Remix converts interleaved samples between channel counts. Mono is copied to every channel,
+// several channels are averaged down to mono, other layouts keep the first channels.
+func Remix(samples []int16, from, to int) []int16 {
+	if from == to {
+		return samples
+	}
+	frames := len(samples) / from
+	out := make([]int16, frames*to)
+	for f := 0; f < frames; f++ {
+		in := samples[f*from : (f+1)*from]
+		switch {
+		case to == 1:
+			var sum int
+			for _, s := range in {
+				sum += int(s)
+			}
+			out[f] = int16(sum / from)
+		case from == 1:
+			for c := 0; c < to; c++ {
+				out[f*to+c] = in[0]
+			}
+		default:
+			for c := 0; c < to; c++ {
+				out[f*to+c] = in[min(c, from-1)]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,25 @@
+package convert
+
+import "math"
+
+// MaxAudioLevel is the quietest level RFC 6464 can express, -127 dBov
+const MaxAudioLevel = 127
+
+// AudioLevel returns the frame level as in RFC 6464: attenuation in dB below
+// full scale (dBov) from 0 (loudest) to 127 (silence)
+func AudioLevel(samples []int16) uint8 {
+	if len(samples) == 0 {
+		return MaxAudioLevel
+	}
+	var sum float64
+	for _, s := range samples {
+		v := float64(s) / 32768
+		sum += v * v
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms == 0 {
+		return MaxAudioLevel
+	}
+	level := -20 * math.Log10(rms)
+	return uint8(math.Round(min(max(level, 0), MaxAudioLevel)))
+}
@@ -0,0 +1,35 @@
+package convert
+
+import "testing"
+
+func constant(n int, value int16) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = value
+	}
+	return samples
+}
+
+func TestAudioLevel(t *testing.T) {
+	oneInAMillion := make([]int16, 1<<20)
+	oneInAMillion[0] = 1
+
+	for _, tc := range []struct {
+		name    string
+		samples []int16
+		want    uint8
+	}{
+		{"empty", nil, MaxAudioLevel},
+		{"digital silence", constant(160, 0), MaxAudioLevel},
+		{"full scale", constant(160, -32768), 0},
+		{"-20 dBov", constant(160, 3277), 20},
+		{"-6.4 dBov rounds down", constant(160, 15697), 6},
+		{"-6.6 dBov rounds up", constant(160, 15340), 7},
+		{"smallest sample", constant(160, 1), 90},
+		{"below -127 dBov clamps", oneInAMillion, MaxAudioLevel},
+	} {
+		if got := AudioLevel(tc.samples); got != tc.want {
+			t.Errorf("%s: level %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
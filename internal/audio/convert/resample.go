@@ -0,0 +1,161 @@
+package convert
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	resampleZeroCrossings = 16   // filter half width in zero crossings of the cutoff frequency
+	resampleOversample    = 512  // filter table points per zero crossing, interpolated linearly between
+	resampleRolloff       = 0.94 // cutoff relative to the lower Nyquist frequency, leaves room for the transition band
+	resampleKaiserBeta    = 8.6  // about 85 dB stopband attenuation
+)
+
+// Resampler converts interleaved audio between sample rates with a windowed sinc filter.
+// It keeps state between calls, so a stream can be converted in blocks of any size.
+// Any ratio works, e.g. 44100 to 8000 Hz.
+type Resampler struct {
+	from, to int
+	channels int
+	step     float64     // input frames per output frame
+	cutoff   float64     // relative to the input rate
+	half     float64     // filter half width in input frames
+	table    []float64   // filter from the center outwards, resampleOversample points per zero crossing
+	history  [][]float64 // input per channel not consumed yet
+	pos      float64     // position of the next output frame in history
+}
+
+// NewResampler creates a resampler for interleaved audio with the given channel count
+func NewResampler(from, to, channels int) *Resampler {
+	r := &Resampler{
+		from:     from,
+		to:       to,
+		channels: channels,
+		step:     float64(from) / float64(to),
+		cutoff:   resampleRolloff * min(1, float64(to)/float64(from)),
+		history:  make([][]float64, channels),
+	}
+	r.half = resampleZeroCrossings / r.cutoff
+
+	r.table = make([]float64, resampleZeroCrossings*resampleOversample+2)
+	for i := range r.table {
+		x := float64(i) / resampleOversample // in zero crossings
+		r.table[i] = sinc(x) * kaiser(x/resampleZeroCrossings, resampleKaiserBeta)
+	}
+
+	// the first output is centered on the first input, the half before it is silence
+	lead := int(math.Ceil(r.half))
+	for c := range r.history {
+		r.history[c] = make([]float64, lead)
+	}
+	r.pos = float64(lead)
+	return r
+}
+
+// Rates returns the input and output sample rates
+func (r *Resampler) Rates() (from, to int) {
+	return r.from, r.to
+}
+
+// Delay is how late the output is compared to the input, half the filter length
+func (r *Resampler) Delay() time.Duration {
+	if r.from == r.to {
+		return 0
+	}
+	return time.Duration(r.half * float64(time.Second) / float64(r.from))
+}
+
+// Process converts interleaved input samples and returns the output that is ready,
+// the filter tail waits for the next call
+func (r *Resampler) Process(in []int16) []int16 {
+	if r.from == r.to {
+		return in
+	}
+	frames := len(in) / r.channels
+	for c := range r.history {
+		for f := 0; f < frames; f++ {
+			r.history[c] = append(r.history[c], float64(in[f*r.channels+c]))
+		}
+	}
+
+	available := len(r.history[0])
+	reach := int(math.Ceil(r.half))
+	var out []int16
+	for int(r.pos)+reach < available {
+		for c := range r.history {
+			out = append(out, clampSample(r.interpolate(r.history[c], r.pos)))
+		}
+		r.pos += r.step
+	}
+
+	// keep what the next outputs still reach back to
+	drop := max(int(r.pos)-reach, 0)
+	for c := range r.history {
+		r.history[c] = append(r.history[c][:0], r.history[c][drop:]...)
+	}
+	r.pos -= float64(drop)
+	return out
+}
+
+// Need returns how many input frames produce at least frames output frames in the next call
+func (r *Resampler) Need(frames int) int {
+	if r.from == r.to || frames <= 0 {
+		return max(frames, 0)
+	}
+	last := r.pos + float64(frames-1)*r.step
+	need := int(last) + int(math.Ceil(r.half)) + 1 - len(r.history[0])
+	return max(need, 0)
+}
+
+// interpolate evaluates the filtered signal at a fractional position in input frames
+func (r *Resampler) interpolate(samples []float64, pos float64) float64 {
+	reach := int(math.Ceil(r.half))
+	center := int(pos)
+	var sum float64
+	for i := max(center-reach+1, 0); i <= center+reach && i < len(samples); i++ {
+		x := math.Abs(pos-float64(i)) * r.cutoff // in zero crossings
+		sum += samples[i] * r.kernel(x)
+	}
+	return sum * r.cutoff
+}
+
+// kernel looks the filter up at x zero crossings from the center
+func (r *Resampler) kernel(x float64) float64 {
+	idx := x * resampleOversample
+	i := int(idx)
+	if i >= len(r.table)-1 {
+		return 0
+	}
+	frac := idx - float64(i)
+	return r.table[i]*(1-frac) + r.table[i+1]*frac
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser is the Kaiser window at x from -1 to 1
+func kaiser(x, beta float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+func clampSample(v float64) int16 {
+	return int16(math.Round(min(max(v, math.MinInt16), math.MaxInt16)))
+}
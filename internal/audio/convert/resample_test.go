@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"math"
+	"testing"
+)
+
+func tone(freq float64, rate, frames int, amplitude float64) []int16 {
+	out := make([]int16, frames)
+	for i := range out {
+		out[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return out
+}
+
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestResamplerKeepsPassband(t *testing.T) {
+	for _, rates := range [][2]int{{48000, 8000}, {44100, 48000}, {8000, 48000}, {44100, 16000}} {
+		r := NewResampler(rates[0], rates[1], 1)
+		out := r.Process(tone(1000, rates[0], rates[0], 10000))
+
+		// the filter tail waits for more input, up to one input frame more than the delay
+		wantFrames := rates[1] - int(r.Delay().Seconds()*float64(rates[1]))
+		slack := rates[1]/rates[0] + 2
+		if diff := len(out) - wantFrames; diff < -slack || diff > slack {
+			t.Errorf("%v: %d frames out, want about %d", rates, len(out), wantFrames)
+		}
+		// skip the filter warm up at the start
+		got := rms(out[len(out)/4:])
+		if want := 10000 / math.Sqrt2; math.Abs(got-want) > want*0.01 {
+			t.Errorf("%v: 1 kHz tone rms %.0f, want %.0f", rates, got, want)
+		}
+	}
+}
+
+func TestResamplerRemovesAliases(t *testing.T) {
+	// 6 kHz can't be represented at 8 kHz and would fold back to 2 kHz
+	r := NewResampler(48000, 8000, 1)
+	out := r.Process(tone(6000, 48000, 48000, 10000))
+	if got := rms(out[len(out)/4:]); got > 10 {
+		t.Errorf("6 kHz tone leaks through with rms %.1f", got)
+	}
+}
+
+func TestResamplerBlocksMatchWhole(t *testing.T) {
+	in := make([]int16, 0, 2*4410)
+	for _, s := range tone(440, 44100, 4410, 8000) {
+		in = append(in, s, -s) // stereo, channels must stay apart
+	}
+
+	whole := NewResampler(44100, 48000, 2).Process(in)
+
+	r := NewResampler(44100, 48000, 2)
+	var blocks []int16
+	for start := 0; start < len(in); start += 2 * 441 {
+		blocks = append(blocks, r.Process(in[start:min(start+2*441, len(in))])...)
+	}
+
+	if len(blocks) != len(whole) {
+		t.Fatalf("blocks gave %d samples, whole %d", len(blocks), len(whole))
+	}
+	for i := range whole {
+		if blocks[i] != whole[i] {
+			t.Fatalf("sample %d differs: %d vs %d", i, blocks[i], whole[i])
+		}
+		if i%2 == 1 && whole[i] != -whole[i-1] && whole[i] != -whole[i-1]-1 && whole[i] != -whole[i-1]+1 {
+			t.Fatalf("channels mixed at frame %d: %d, %d", i/2, whole[i-1], whole[i])
+		}
+	}
+}
+
+func TestResamplerNeed(t *testing.T) {
+	r := NewResampler(8000, 44100, 1)
+	for _, frames := range []int{441, 1, 512, 100} {
+		out := r.Process(make([]int16, r.Need(frames)))
+		if len(out) < frames || len(out) > frames+6 {
+			t.Errorf("Need(%d) produced %d frames", frames, len(out))
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"unsafe"
+
+	"github.com/gen2brain/malgo"
+)
+
+var ErrNoDevice = errors.New("no matching audio device")
+
+// Change is reported when a device went away during a call and audio moved to another one
+type Change struct {
+	Kind malgo.DeviceType
+	Lost string // name of the device that stopped
+	Now  string // name of the device in use now, empty while none could be opened
+	Err  error  // why no device could be opened
+}
+
+func (c Change) String() string {
+	kind := "output"
+	if c.Kind == malgo.Capture {
+		kind = "input"
+	}
+	if c.Now == "" {
+		return fmt.Sprintf("Audio %s %q is gone and no other device is available: %v", kind, c.Lost, c.Err)
+	}
+	if c.Lost == "" {
+		return fmt.Sprintf("Audio %s is back on %q", kind, c.Now)
+	}
+	return fmt.Sprintf("Audio %s moved from %q to %q", kind, c.Lost, c.Now)
+}
+
+// Format is a native format of a device, zero channels or rate means the device takes any
+type Format struct {
+	Sample     string
+	Channels   int
+	SampleRate int
+}
+
+func (f Format) String() string {
+	channels, rate := "any channels", "any rate"
+	if f.Channels > 0 {
+		channels = fmt.Sprintf("%d ch", f.Channels)
+	}
+	if f.SampleRate > 0 {
+		rate = fmt.Sprintf("%d Hz", f.SampleRate)
+	}
+	return fmt.Sprintf("%s %s %s", f.Sample, channels, rate)
+}
+
+// Info describes a capture or playback device
+type Info struct {
+	ID      string // hex form of the backend device id, stable while the device is plugged in
+	Name    string
+	Default bool
+	Formats []Format
+	id      malgo.DeviceID
+}
+
+// Devices lists the capture and playback devices with their native formats
+func Devices() (capture, playback []Info, err error) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init malgo context: %w", err)
+	}
+	defer func() {
+		_ = ctx.Uninit()
+		ctx.Free()
+	}()
+
+	if capture, err = List(ctx.Context, malgo.Capture); err != nil {
+		return nil, nil, err
+	}
+	if playback, err = List(ctx.Context, malgo.Playback); err != nil {
+		return nil, nil, err
+	}
+	return capture, playback, nil
+}
+
+// List returns the devices of one kind, formats are queried per device
+func List(ctx malgo.Context, kind malgo.DeviceType) ([]Info, error) {
+	infos, err := Scan(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		// enumeration leaves formats out, they need a query of their own
+		full, err := ctx.DeviceInfo(kind, infos[i].id, malgo.Shared)
+		if err != nil {
+			log.Printf("Failed to query formats of %s: %v", infos[i].Name, err)
+			continue
+		}
+		for _, f := range full.Formats {
+			infos[i].Formats = append(infos[i].Formats, Format{
+				Sample:     sampleName(f.Format),
+				Channels:   int(f.Channels),
+				SampleRate: int(f.SampleRate),
+			})
+		}
+	}
+	return infos, nil
+}
+
+// Scan returns the devices of one kind without their formats, cheap enough to poll
+func Scan(ctx malgo.Context, kind malgo.DeviceType) ([]Info, error) {
+	devices, err := ctx.Devices(kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	infos := make([]Info, 0, len(devices))
+	for _, d := range devices {
+		infos = append(infos, Info{ID: d.ID.String(), Name: d.Name(), Default: d.IsDefault != 0, id: d.ID})
+	}
+	return infos, nil
+}
+
+// Find returns the device selected by an exact id or a part of its name,
+// an empty selector returns the current default device
+func Find(ctx malgo.Context, kind malgo.DeviceType, selector string) (Info, error) {
+	devices, err := Scan(ctx, kind)
+	if err != nil {
+		if selector == "" {
+			// the default device can still be opened without knowing which one it is
+			return Info{Name: "default device", Default: true}, nil
+		}
+		return Info{}, err
+	}
+	return Select(devices, selector)
+}
+
+// Select picks the device for a selector from a list, an empty selector picks the default
+func Select(devices []Info, selector string) (Info, error) {
+	if selector == "" {
+		return Default(devices)
+	}
+	return Match(devices, selector)
+}
+
+// Present reports whether the device with the id is still in the list
+func Present(devices []Info, id string) bool {
+	for _, d := range devices {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Default returns the device marked as default, or the first one when the backend marks none
+func Default(devices []Info) (Info, error) {
+	if len(devices) == 0 {
+		return Info{}, ErrNoDevice
+	}
+	for _, d := range devices {
+		if d.Default {
+			return d, nil
+		}
+	}
+	d := devices[0]
+	d.Default = true
+	return d, nil
+}
+
+// Pointer returns the device id in C memory for malgo.DeviceConfig
+func (i Info) Pointer() unsafe.Pointer {
+	return i.id.Pointer()
+}
+
+// Candidates lists the devices to try in order when the one in use goes away:
+// the selected device, the fallback, then the default
+func Candidates(selector, fallback string) []string {
+	candidates := []string{selector}
+	if fallback != "" && fallback != selector {
+		candidates = append(candidates, fallback)
+	}
+	if selector != "" {
+		candidates = append(candidates, "")
+	}
+	return candidates
+}
+
+// Match selects a device by exact id, then by case insensitive name substring.
+// A substring matching several devices is an error so the wrong device isn't picked silently.
+func Match(devices []Info, selector string) (Info, error) {
+	for _, d := range devices {
+		if d.ID == selector {
+			return d, nil
+		}
+	}
+
+	var matches []Info
+	needle := strings.ToLower(selector)
+	for _, d := range devices {
+		if strings.Contains(strings.ToLower(d.Name), needle) {
+			matches = append(matches, d)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Info{}, fmt.Errorf("%w: %q", ErrNoDevice, selector)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, d := range matches {
+		names[i] = fmt.Sprintf("%q", d.Name)
+	}
+	return Info{}, fmt.Errorf("%q matches several devices: %s", selector, strings.Join(names, ", "))
+}
+
+// Print writes a device list in the format shown by the devices command
+func Print(w io.Writer, title string, devices []Info) {
+	fmt.Fprintf(w, "%s:\n", title)
+	if len(devices) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, d := range devices {
+		marker := " "
+		if d.Default {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %s  %s\n", marker, d.ID, d.Name)
+		for _, f := range d.Formats {
+			fmt.Fprintf(w, "      %s\n", f)
+		}
+	}
+}
+
+func sampleName(format malgo.FormatType) string {
+	switch format {
+	case malgo.FormatU8:
+		return "u8"
+	case malgo.FormatS16:
+		return "s16"
+	case malgo.FormatS24:
+		return "s24"
+	case malgo.FormatS32:
+		return "s32"
+	case malgo.FormatF32:
+		return "f32"
+	default:
+		return "any format"
+	}
+}
@@ -0,0 +1,81 @@
+package device
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var devices = []Info{
+	{ID: "0a", Name: "Built-in Microphone", Default: true},
+	{ID: "1b", Name: "USB Headset Microphone"},
+	{ID: "2c", Name: "USB Webcam"},
+}
+
+func TestMatchByID(t *testing.T) {
+	got, err := Match(devices, "2c")
+	if err != nil || got.Name != "USB Webcam" {
+		t.Fatalf("Match(2c) = %q, %v", got.Name, err)
+	}
+}
+
+func TestMatchByName(t *testing.T) {
+	got, err := Match(devices, "headset")
+	if err != nil || got.ID != "1b" {
+		t.Fatalf("Match(headset) = %q, %v", got.ID, err)
+	}
+}
+
+func TestMatchRejectsAmbiguousAndUnknown(t *testing.T) {
+	if _, err := Match(devices, "usb"); err == nil || !strings.Contains(err.Error(), "several") {
+		t.Errorf("Match(usb) = %v, want ambiguity error", err)
+	}
+	if _, err := Match(devices, "bluetooth"); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Match(bluetooth) = %v, want ErrNoDevice", err)
+	}
+}
+
+func TestFormatString(t *testing.T) {
+	if got := (Format{Sample: "s16", Channels: 2, SampleRate: 44100}).String(); got != "s16 2 ch 44100 Hz" {
+		t.Errorf("got %q", got)
+	}
+	if got := (Format{Sample: "f32"}).String(); got != "f32 any channels any rate" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSelectDefault(t *testing.T) {
+	got, err := Select(devices, "")
+	if err != nil || got.ID != "0a" {
+		t.Fatalf("Select(\"\") = %q, %v", got.ID, err)
+	}
+	got, err = Default(devices[1:])
+	if err != nil || got.ID != "1b" || !got.Default {
+		t.Errorf("Default without a marked device = %+v, %v, want the first one", got, err)
+	}
+	if _, err := Default(nil); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Default(nil) = %v, want ErrNoDevice", err)
+	}
+	if !Present(devices, "2c") || Present(devices, "3d") {
+		t.Error("Present doesn't follow the list")
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	cases := []struct {
+		selector, fallback string
+		want               []string
+	}{
+		{"", "", []string{""}},
+		{"headset", "", []string{"headset", ""}},
+		{"headset", "speaker", []string{"headset", "speaker", ""}},
+		{"headset", "headset", []string{"headset", ""}},
+		{"", "speaker", []string{"", "speaker"}},
+	}
+	for _, c := range cases {
+		got := Candidates(c.selector, c.fallback)
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("Candidates(%q, %q) = %q, want %q", c.selector, c.fallback, got, c.want)
+		}
+	}
+}
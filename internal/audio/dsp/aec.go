@@ -0,0 +1,333 @@
+package dsp
+
+import (
+	"log"
+	"math"
+	"math/cmplx"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	aecBlock          = 5 * time.Millisecond   // filter block, rounded up to a power of two in samples
+	aecStep           = 0.5                    // adaptation step of the normalised filter update
+	aecDoubleTalk     = 4.0                    // near end this much above the learned echo level is double talk, 6 dB
+	aecERLRise        = 1.01                   // per block, how fast the learned echo level follows louder echo
+	aecERLRiseSettled = 1.0005                 // the same once the filter removes echo, near end speech must not teach it
+	aecDoubleTalkHold = 100 * time.Millisecond // adaptation stays frozen this long after double talk
+	aecFarFloor       = 100.0                  // far end peak below which there is nothing to learn from
+	aecDelayWindow    = 2 * time.Second        // level history correlated to find the delay
+	aecDelayEvery     = 500 * time.Millisecond
+	aecDelayMargin    = 2 // blocks of the estimated delay left to the filter, the estimate is coarse
+)
+
+// EchoStats describes the state of the echo canceller
+type EchoStats struct {
+	Delay      time.Duration // estimated delay of the echo, beyond what pairing the two paths adds
+	ERLE       float64       // echo return loss enhancement in dB, how much echo is removed
+	DoubleTalk bool          // both sides are talking, the filter is not adapting
+}
+
+// EchoCanceller removes what the speaker plays from the microphone signal.
+// Reference is fed from the playback path and Process runs on captured audio, both mono at one rate.
+// The echo path is modelled by a partitioned block frequency domain adaptive filter placed
+// after a bulk delay found from the level envelopes of both sides. Adaptation freezes while
+// both sides talk so the near end speech doesn't pull the filter away.
+type EchoCanceller struct {
+	rate  int
+	block int // samples per block
+	parts int // filter partitions of one block each
+	fftN  int
+
+	mu      sync.Mutex // guards the reference fifo, Reference and Process run on different threads
+	fifo    []int16
+	primed  bool // the fifo holds enough to pair samples without running dry
+	maxPush int
+	maxPop  int
+	resync  bool // the pairing moved, the delay has to be found again
+
+	near     []float64 // captured samples waiting for a whole block
+	farQueue []float64 // reference samples paired with near
+	out      []int16   // processed samples not returned yet, starts with one block of silence
+	history  []float64 // reference before the current block, newest last
+	lag      int       // estimated echo delay in blocks
+	delay    int       // reference samples skipped before the filter
+	maxDelay int
+
+	X, W                [][]complex128 // reference spectra (newest first) and filter weights per partition
+	buf                 []complex128
+	err                 []complex128
+	next                int // partition whose weights are constrained next
+	estimate            *delayEstimator
+	hold                int     // blocks left with adaptation frozen
+	erl                 float64 // learned echo to far end power ratio, the echo return loss
+	nearLevel, farLevel float64 // smoothed powers compared by the double talk detector
+
+	nearPower, errPower float64 // smoothed while echo alone is present, for ERLE
+	stats               atomic.Pointer[EchoStats]
+}
+
+// NewEchoCanceller creates a canceller for mono audio at rate. tail is how long the room keeps
+// echoing, maxDelay the longest delay between playing and capturing the echo that is searched for.
+func NewEchoCanceller(rate int, tail, maxDelay time.Duration) *EchoCanceller {
+	block := nextPow2(int(aecBlock * time.Duration(rate) / time.Second))
+	blockDur := time.Duration(block) * time.Second / time.Duration(rate)
+	parts := max(int((tail+blockDur-1)/blockDur)+aecDelayMargin, 1)
+	maxLag := int(maxDelay / blockDur)
+
+	ec := &EchoCanceller{
+		rate:     rate,
+		block:    block,
+		parts:    parts,
+		fftN:     2 * block,
+		out:      make([]int16, block),
+		maxDelay: maxLag * block,
+		history:  make([]float64, maxLag*block+(parts+1)*block),
+		X:        make([][]complex128, parts),
+		W:        make([][]complex128, parts),
+		buf:      make([]complex128, 2*block),
+		err:      make([]complex128, 2*block),
+		estimate: newDelayEstimator(int(aecDelayWindow/blockDur), maxLag, int(aecDelayEvery/blockDur)),
+	}
+	for p := range ec.X {
+		ec.X[p] = make([]complex128, ec.fftN)
+		ec.W[p] = make([]complex128, ec.fftN)
+	}
+	ec.erl = 1
+	ec.stats.Store(&EchoStats{})
+	return ec
+}
+
+// Reference passes the audio about to be played, the echo Process removes later
+func (ec *EchoCanceller) Reference(samples []int16) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.fifo = append(ec.fifo, samples...)
+	ec.maxPush = max(ec.maxPush, len(samples))
+	if len(ec.fifo) > ec.rate {
+		// capture isn't taking the reference, pair again once it does
+		ec.fifo = ec.fifo[:0]
+		ec.primed = false
+	}
+}
+
+// Latency is how late Process returns audio, one block
+func (ec *EchoCanceller) Latency() time.Duration {
+	return time.Duration(ec.block) * time.Second / time.Duration(ec.rate)
+}
+
+// Stats returns the current delay estimate, echo reduction and double talk state
+func (ec *EchoCanceller) Stats() EchoStats {
+	return *ec.stats.Load()
+}
+
+// Process removes the echo from captured samples in place
+func (ec *EchoCanceller) Process(samples []int16) {
+	ec.farQueue = append(ec.farQueue, ec.takeReference(len(samples))...)
+	for _, s := range samples {
+		ec.near = append(ec.near, float64(s))
+	}
+
+	processed := 0
+	for len(ec.near)-processed >= ec.block {
+		ec.processBlock(ec.near[processed:processed+ec.block], ec.farQueue[processed:processed+ec.block])
+		processed += ec.block
+	}
+	ec.near = append(ec.near[:0], ec.near[processed:]...)
+	ec.farQueue = append(ec.farQueue[:0], ec.farQueue[processed:]...)
+
+	n := copy(samples, ec.out)
+	ec.out = append(ec.out[:0], ec.out[n:]...)
+}
+
+// takeReference returns the reference samples paired with n captured samples.
+// The fifo is drained only once it holds the largest write of either side, so the pairing
+// stays fixed while both sides run at the same rate.
+func (ec *EchoCanceller) takeReference(n int) []float64 {
+	far := make([]float64, n)
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.maxPop = max(ec.maxPop, n)
+	if !ec.primed {
+		target := ec.maxPush + ec.maxPop
+		if ec.maxPush == 0 || len(ec.fifo) < target {
+			return far
+		}
+		ec.fifo = append(ec.fifo[:0], ec.fifo[len(ec.fifo)-target:]...)
+		ec.primed = true
+		ec.resync = true
+	}
+	if len(ec.fifo) < n {
+		// playback fell behind or stopped
+		ec.primed = false
+		return far
+	}
+	for i := range far {
+		far[i] = float64(ec.fifo[i])
+	}
+	ec.fifo = append(ec.fifo[:0], ec.fifo[n:]...)
+	return far
+}
+
+// processBlock cancels the echo in one block and adapts the filter
+func (ec *EchoCanceller) processBlock(near, far []float64) {
+	ec.mu.Lock()
+	resync := ec.resync
+	ec.resync = false
+	ec.mu.Unlock()
+	if resync {
+		ec.estimate.reset()
+	}
+
+	copy(ec.history, ec.history[ec.block:])
+	copy(ec.history[len(ec.history)-ec.block:], far)
+
+	// near end speech would mislead the estimate
+	lag, changed := ec.lag, false
+	if ec.hold == 0 {
+		lag, changed = ec.estimate.push(meanAbs(near), meanAbs(far))
+	}
+	if changed {
+		ec.lag = lag
+		ec.delay = max(lag-aecDelayMargin, 0) * ec.block
+		ec.reset()
+		log.Printf("Echo delay estimated at %v", ec.samplesDuration(lag*ec.block))
+	}
+
+	// the reference window ending delay samples before the block, two blocks for overlap save
+	end := len(ec.history) - ec.delay
+	window := ec.history[end-ec.fftN : end]
+
+	// newest spectrum first, the oldest one is reused
+	oldest := ec.X[ec.parts-1]
+	copy(ec.X[1:], ec.X[:ec.parts-1])
+	ec.X[0] = oldest
+	for i, v := range window {
+		ec.X[0][i] = complex(v, 0)
+	}
+	fft(ec.X[0], false)
+
+	// echo estimate, the second half of the circular convolution is linear
+	clear(ec.buf)
+	for p := range ec.W {
+		for k, w := range ec.W[p] {
+			ec.buf[k] += w * ec.X[p][k]
+		}
+	}
+	fft(ec.buf, true)
+
+	clear(ec.err)
+	var nearEnergy, errEnergy float64
+	out := make([]float64, ec.block)
+	for i := range out {
+		out[i] = near[i] - real(ec.buf[ec.block+i])
+		ec.err[ec.block+i] = complex(out[i], 0)
+		nearEnergy += near[i] * near[i]
+		errEnergy += out[i] * out[i]
+	}
+
+	// Geigel style detector on power: echo alone stays near the learned echo return loss
+	// from the far end over the filter span, the near end talking lifts the microphone above it
+	var farEnergy, farPeak float64
+	for _, v := range ec.history[end-ec.parts*ec.block : end] {
+		farEnergy += v * v
+		farPeak = max(farPeak, math.Abs(v))
+	}
+	farActive := farPeak > aecFarFloor
+	if farActive {
+		ec.nearLevel = 0.7*ec.nearLevel + 0.3*nearEnergy/float64(ec.block)
+		ec.farLevel = 0.7*ec.farLevel + 0.3*farEnergy/float64(ec.parts*ec.block)
+		ratio := ec.nearLevel / ec.farLevel
+		if ratio > aecDoubleTalk*ec.erl {
+			ec.hold = int(aecDoubleTalkHold / ec.samplesDuration(ec.block))
+		} else if ec.hold > 0 {
+			ec.hold--
+		}
+		switch {
+		case ratio < ec.erl:
+			ec.erl += 0.05 * (ratio - ec.erl)
+		case ec.nearPower > 4*ec.errPower:
+			ec.erl *= aecERLRiseSettled
+		default:
+			ec.erl *= aecERLRise
+		}
+	} else if ec.hold > 0 {
+		ec.hold--
+	}
+
+	if errEnergy > 4*nearEnergy+float64(ec.block) {
+		// the filter diverged, it adds more than it removes
+		ec.reset()
+		copy(out, near)
+	} else if farActive && ec.hold == 0 {
+		ec.adapt()
+		ec.nearPower = 0.95*ec.nearPower + 0.05*nearEnergy
+		ec.errPower = 0.95*ec.errPower + 0.05*errEnergy
+	}
+
+	for _, v := range out {
+		ec.out = append(ec.out, int16(math.Round(min(max(v, math.MinInt16), math.MaxInt16))))
+	}
+	ec.publish()
+}
+
+// adapt moves the weights along the normalised gradient of the error
+func (ec *EchoCanceller) adapt() {
+	fft(ec.err, false)
+
+	// regularisation keeps quiet bins from blowing up, about -60 dBFS of noise per partition
+	floor := float64(ec.parts*ec.fftN) * 30 * 30
+	for k := range ec.err {
+		var power float64
+		for p := range ec.X {
+			x := ec.X[p][k]
+			power += real(x)*real(x) + imag(x)*imag(x)
+		}
+		step := complex(aecStep/(power+floor), 0)
+		for p := range ec.W {
+			ec.W[p][k] += step * cmplx.Conj(ec.X[p][k]) * ec.err[k]
+		}
+	}
+
+	// keep one partition a linear filter per block, the others follow in turn
+	w := ec.W[ec.next]
+	fft(w, true)
+	clear(w[ec.block:])
+	fft(w, false)
+	ec.next = (ec.next + 1) % ec.parts
+}
+
+// reset forgets the echo path, after the delay moved or the filter diverged
+func (ec *EchoCanceller) reset() {
+	for p := range ec.W {
+		clear(ec.W[p])
+		clear(ec.X[p])
+	}
+	ec.hold = 0
+}
+
+func (ec *EchoCanceller) publish() {
+	erle := 0.0
+	if ec.errPower > 0 && ec.nearPower > 0 {
+		erle = 10 * math.Log10(ec.nearPower/ec.errPower)
+	}
+	ec.stats.Store(&EchoStats{
+		Delay:      ec.samplesDuration(ec.lag * ec.block),
+		ERLE:       erle,
+		DoubleTalk: ec.hold > 0,
+	})
+}
+
+func (ec *EchoCanceller) samplesDuration(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(ec.rate)
+}
+
+func meanAbs(s []float64) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += math.Abs(v)
+	}
+	return sum / float64(len(s))
+}
@@ -0,0 +1,179 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// room plays far end audio into a microphone: a delayed, decaying echo
+type room struct {
+	delay   int
+	taps    []float64
+	played  []float64
+	noise   *rand.Rand
+	talking func(i int) float64 // near end speech, nil for none
+	spoken  []float64
+}
+
+func newRoom(rate int, delay time.Duration) *room {
+	r := &room{delay: int(delay * time.Duration(rate) / time.Second), noise: rand.New(rand.NewSource(2))}
+	r.taps = make([]float64, rate/100) // 10 ms of reflections
+	for i := range r.taps {
+		r.taps[i] = 0.1 * math.Exp(-float64(i)/float64(len(r.taps)/4)) * (r.noise.Float64()*2 - 1)
+	}
+	r.taps[0] = 0.3
+	return r
+}
+
+// capture returns what the microphone picks up for the next n samples
+func (r *room) capture(n int) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		t := len(r.played) - n + i - r.delay
+		var v float64
+		for k, tap := range r.taps {
+			if t-k >= 0 && t-k < len(r.played) {
+				v += tap * r.played[t-k]
+			}
+		}
+		speech := 0.0
+		if r.talking != nil {
+			speech = r.talking(len(r.spoken))
+		}
+		r.spoken = append(r.spoken, speech)
+		out[i] = int16(v + speech)
+	}
+	return out
+}
+
+// speech is noise with a syllable like envelope so the levels of both sides can be matched
+func speech(seed int64, rate int) func(i int) float64 {
+	noise := rand.New(rand.NewSource(seed))
+	return func(i int) float64 {
+		syllable := i / (rate / 8)
+		envelope := 0.2 + 0.8*math.Abs(math.Sin(float64(syllable)*1.7+float64(seed)))
+		return 6000 * envelope * (noise.Float64()*2 - 1)
+	}
+}
+
+func energy(s []int16) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += float64(v) * float64(v)
+	}
+	return sum
+}
+
+// call runs seconds of audio through the canceller in 10 ms chunks like the sound card callbacks
+func call(ec *EchoCanceller, r *room, far func(i int) float64, rate int, seconds float64) (mic, out []int16) {
+	chunk := rate / 100
+	for c := 0; c < int(seconds*100); c++ {
+		played := make([]int16, chunk)
+		for i := range played {
+			played[i] = int16(far(len(r.played)))
+			r.played = append(r.played, float64(played[i]))
+		}
+		ec.Reference(played)
+
+		captured := r.capture(chunk)
+		mic = append(mic, captured...)
+		ec.Process(captured)
+		out = append(out, captured...)
+	}
+	return mic, out
+}
+
+func TestEchoCancellerRemovesEcho(t *testing.T) {
+	const rate = 16000
+	ec := NewEchoCanceller(rate, 64*time.Millisecond, 300*time.Millisecond)
+	r := newRoom(rate, 80*time.Millisecond)
+
+	mic, out := call(ec, r, speech(1, rate), rate, 10)
+
+	tail := len(mic) - 2*rate
+	erle := 10 * math.Log10(energy(mic[tail:])/energy(out[tail:]))
+	if erle < 20 {
+		t.Errorf("echo reduced by %.1f dB, want at least 20", erle)
+	}
+	stats := ec.Stats()
+	if stats.Delay <= 0 || stats.Delay > 80*time.Millisecond {
+		t.Errorf("delay estimated at %v, want below the 80 ms echo path", stats.Delay)
+	}
+}
+
+func TestEchoCancellerKeepsNearEndDuringDoubleTalk(t *testing.T) {
+	const rate = 16000
+	ec := NewEchoCanceller(rate, 64*time.Millisecond, 300*time.Millisecond)
+	r := newRoom(rate, 60*time.Millisecond)
+	far := speech(1, rate)
+	call(ec, r, far, rate, 6)
+
+	// both sides talk, the near end must come through and the filter must not lose the echo
+	start := len(r.spoken)
+	r.talking = speech(7, rate)
+	_, out := call(ec, r, far, rate, 3)
+
+	latency := int(ec.Latency() * rate / time.Second)
+	var residual float64
+	for i := latency; i < len(out); i++ {
+		d := float64(out[i]) - r.spoken[start+i-latency]
+		residual += d * d
+	}
+	var spoken float64
+	for _, v := range r.spoken[start:] {
+		spoken += v * v
+	}
+	if snr := 10 * math.Log10(spoken/residual); snr < 15 {
+		t.Errorf("near end speech to residual echo %.1f dB, want at least 15", snr)
+	}
+}
+
+func TestEchoCancellerPassesAudioWithoutReference(t *testing.T) {
+	ec := NewEchoCanceller(8000, 32*time.Millisecond, 100*time.Millisecond)
+	in := make([]int16, 8000)
+	for i := range in {
+		in[i] = int16(3000 * math.Sin(float64(i)/5))
+	}
+	out := append([]int16(nil), in...)
+	for i := 0; i < len(out); i += 160 {
+		ec.Process(out[i : i+160])
+	}
+	latency := int(ec.Latency() * 8000 / time.Second)
+	for i := latency; i < len(out); i++ {
+		if out[i] != in[i-latency] {
+			t.Fatalf("sample %d changed to %d from %d", i, out[i], in[i-latency])
+		}
+	}
+}
+
+func TestFFTRoundTrip(t *testing.T) {
+	x := make([]complex128, 64)
+	for i := range x {
+		x[i] = complex(float64(i%7), 0)
+	}
+	y := append([]complex128(nil), x...)
+	fft(y, false)
+	if got := real(y[0]); math.Abs(got-sumReal(x)) > 1e-9 {
+		t.Errorf("DC bin %v, want %v", got, sumReal(x))
+	}
+	fft(y, true)
+	for i := range x {
+		if cmplxAbs(y[i]-x[i]) > 1e-9 {
+			t.Fatalf("sample %d: %v, want %v", i, y[i], x[i])
+		}
+	}
+}
+
+func sumReal(x []complex128) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += real(v)
+	}
+	return sum
+}
+
+func cmplxAbs(c complex128) float64 {
+	return math.Hypot(real(c), imag(c))
+}
@@ -0,0 +1,109 @@
+package dsp
+
+import "math"
+
+const (
+	delayMinCorrelation = 0.4 // weaker matches are more likely near end speech than echo
+	delayConfirmations  = 2   // estimates in a row needed before the delay moves
+)
+
+// delayEstimator finds how many blocks the echo lags behind the far end signal
+// by correlating the level envelopes of both sides
+type delayEstimator struct {
+	near, far []float64 // block levels, newest last; far holds maxLag more blocks
+	window    int       // blocks correlated
+	maxLag    int
+	every     int // blocks between estimates
+	blocks    int
+	lag       int
+	candidate int
+	seen      int // times candidate was found in a row
+}
+
+func newDelayEstimator(window, maxLag, every int) *delayEstimator {
+	return &delayEstimator{window: window, maxLag: maxLag, every: every, candidate: -1}
+}
+
+// push adds the levels of one block and returns the current lag, changed is set when it moved
+func (d *delayEstimator) push(near, far float64) (lag int, changed bool) {
+	d.near = appendBounded(d.near, near, d.window)
+	d.far = appendBounded(d.far, far, d.window+d.maxLag)
+
+	d.blocks++
+	if d.blocks < d.every || len(d.far) < d.window+d.maxLag {
+		return d.lag, false
+	}
+	d.blocks = 0
+
+	found, ok := d.estimate()
+	if !ok {
+		return d.lag, false
+	}
+	if abs(found-d.candidate) <= 1 {
+		d.seen++
+	} else {
+		d.candidate, d.seen = found, 1
+	}
+	if d.seen < delayConfirmations || found == d.lag {
+		return d.lag, false
+	}
+	d.lag = found
+	return d.lag, true
+}
+
+// estimate returns the lag with the strongest correlation, ok is false without a clear match
+func (d *delayEstimator) estimate() (lag int, ok bool) {
+	nearMean, nearDev := meanDev(d.near)
+	if nearDev == 0 {
+		return 0, false
+	}
+	best := delayMinCorrelation
+	for l := 0; l <= d.maxLag; l++ {
+		far := d.far[d.maxLag-l : d.maxLag-l+d.window]
+		farMean, farDev := meanDev(far)
+		if farDev == 0 {
+			continue
+		}
+		var sum float64
+		for i := range d.near {
+			sum += (d.near[i] - nearMean) * (far[i] - farMean)
+		}
+		if corr := sum / (float64(d.window) * nearDev * farDev); corr > best {
+			best, lag, ok = corr, l, true
+		}
+	}
+	return lag, ok
+}
+
+// reset forgets the history, e.g. after the two signals were realigned
+func (d *delayEstimator) reset() {
+	d.near, d.far = d.near[:0], d.far[:0]
+	d.blocks, d.candidate, d.seen = 0, -1, 0
+}
+
+// appendBounded appends v and keeps the newest size values, append reallocates before the array grows far
+func appendBounded(s []float64, v float64, size int) []float64 {
+	s = append(s, v)
+	if len(s) > size {
+		return s[len(s)-size:]
+	}
+	return s
+}
+
+func meanDev(s []float64) (mean, dev float64) {
+	for _, v := range s {
+		mean += v
+	}
+	mean /= float64(len(s))
+	for _, v := range s {
+		dev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(dev / float64(len(s)))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
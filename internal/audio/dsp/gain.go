@@ -0,0 +1,162 @@
+package dsp
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	gainBlock        = 10 * time.Millisecond // level measured and gain updated per block
+	gainSpeechFloor  = -50.0                 // dBFS, quieter blocks are pauses and leave the gain alone
+	gainMinDB        = -20.0                 // strongest attenuation of loud speech
+	gainCeilingDB    = -1.0                  // dBFS the limiter keeps peaks under
+	gainLimitRelease = 50 * time.Millisecond // how fast the limiter lets go after a peak
+)
+
+// GainConfig sets how the gain control levels the microphone
+type GainConfig struct {
+	Automatic bool          // level speech to Target, otherwise apply Manual
+	Target    float64       // dBFS of speech the automatic gain aims for
+	MaxGain   float64       // dB the automatic gain may raise quiet speech by
+	Attack    time.Duration // how fast the gain drops when speech gets louder
+	Release   time.Duration // how fast the gain rises when speech gets quieter
+	Manual    float64       // dB of gain when not automatic
+}
+
+// GainControl levels speech from quiet and loud microphones to one loudness.
+// The speech level is followed in dB, quickly when it rises and slowly when it falls, and the gain
+// moves smoothly across each block. A limiter after the gain keeps peaks below full scale.
+type GainControl struct {
+	block           int
+	target, maxGain float64
+	attack, release float64 // smoothing per block of the level
+	limitRelease    float64 // per block
+	automatic       atomic.Bool
+	manual          atomic.Uint64 // dB as float64 bits
+	applied         atomic.Uint64 // dB as float64 bits, the gain of the last block including the limiter
+	level           float64       // followed speech level in dBFS, NaN until speech was heard
+	gain, limit     float64       // linear automatic or manual gain and the limiter reduction
+	previous        float64       // linear gain applied at the end of the last block
+	ceiling         float64
+}
+
+// NewGainControl creates a gain control for audio at rate
+func NewGainControl(rate int, cfg GainConfig) *GainControl {
+	block := int(gainBlock * time.Duration(rate) / time.Second)
+	g := &GainControl{
+		block:        block,
+		target:       cfg.Target,
+		maxGain:      cfg.MaxGain,
+		attack:       smoothing(gainBlock, cfg.Attack),
+		release:      smoothing(gainBlock, cfg.Release),
+		limitRelease: smoothing(gainBlock, gainLimitRelease),
+		level:        math.NaN(),
+		gain:         1,
+		limit:        1,
+		previous:     1,
+		ceiling:      math.Pow(10, gainCeilingDB/20) * math.MaxInt16,
+	}
+	g.automatic.Store(cfg.Automatic)
+	g.SetManualGain(cfg.Manual)
+	return g
+}
+
+// SetAutomatic switches between levelling speech and the manual gain
+func (g *GainControl) SetAutomatic(automatic bool) {
+	g.automatic.Store(automatic)
+}
+
+// Automatic reports whether speech is levelled automatically
+func (g *GainControl) Automatic() bool {
+	return g.automatic.Load()
+}
+
+// SetManualGain sets the gain in dB used while not automatic
+func (g *GainControl) SetManualGain(dB float64) {
+	g.manual.Store(math.Float64bits(dB))
+}
+
+// Gain returns the gain in dB applied to the last block, limiter included
+func (g *GainControl) Gain() float64 {
+	return math.Float64frombits(g.applied.Load())
+}
+
+// Process applies the gain to samples in place
+func (g *GainControl) Process(samples []int16) {
+	for len(samples) > 0 {
+		n := min(g.block, len(samples))
+		g.processBlock(samples[:n])
+		samples = samples[n:]
+	}
+}
+
+func (g *GainControl) processBlock(samples []int16) {
+	var sum, peak float64
+	for _, s := range samples {
+		v := float64(s)
+		sum += v * v
+		peak = max(peak, math.Abs(v))
+	}
+
+	if g.automatic.Load() {
+		g.follow(dBFS(math.Sqrt(sum / float64(len(samples)))))
+	} else {
+		g.gain = math.Pow(10, math.Float64frombits(g.manual.Load())/20)
+	}
+
+	// the limiter drops at once so the peak fits, and recovers gradually
+	g.limit += (1 - g.limit) * g.limitRelease
+	next := g.gain * g.limit
+	if peak*max(g.previous, next) > g.ceiling {
+		next = min(next, g.ceiling/peak)
+		g.limit = next / g.gain
+		g.apply(samples, next, next)
+	} else {
+		g.apply(samples, g.previous, next)
+	}
+	g.previous = next
+	g.applied.Store(math.Float64bits(20 * math.Log10(next)))
+}
+
+// follow tracks the speech level and sets the gain that brings it to the target
+func (g *GainControl) follow(level float64) {
+	if level < gainSpeechFloor {
+		return // keep the gain through pauses instead of raising the noise
+	}
+	switch {
+	case math.IsNaN(g.level):
+		g.level = level
+	case level > g.level:
+		g.level += (level - g.level) * g.attack
+	default:
+		g.level += (level - g.level) * g.release
+	}
+	dB := min(max(g.target-g.level, gainMinDB), g.maxGain)
+	g.gain = math.Pow(10, dB/20)
+}
+
+// apply ramps the gain from start to end across samples
+func (g *GainControl) apply(samples []int16, start, end float64) {
+	step := (end - start) / float64(len(samples))
+	for i, s := range samples {
+		v := float64(s) * (start + step*float64(i+1))
+		samples[i] = int16(math.Round(min(max(v, -g.ceiling), g.ceiling)))
+	}
+}
+
+// smoothing is the share of the distance covered per block for a time constant
+func smoothing(block, constant time.Duration) float64 {
+	if constant <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-float64(block)/float64(constant))
+}
+
+// dBFS of an amplitude relative to full scale, very quiet input is clamped to -100
+func dBFS(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return -100
+	}
+	return max(20*math.Log10(amplitude/math.MaxInt16), -100)
+}
@@ -0,0 +1,92 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var testGain = GainConfig{
+	Automatic: true,
+	Target:    -18,
+	MaxGain:   30,
+	Attack:    20 * time.Millisecond,
+	Release:   500 * time.Millisecond,
+}
+
+// level returns the RMS of s in dBFS
+func level(s []int16) float64 {
+	return dBFS(math.Sqrt(energy(s) / float64(len(s))))
+}
+
+// talk runs seconds of speech scaled by gain through g in 20 ms chunks
+func talk(g *GainControl, rate int, seconds, gain float64) []int16 {
+	voice := speech(5, rate)
+	out := make([]int16, int(seconds*float64(rate)))
+	for i := range out {
+		out[i] = int16(min(max(gain*voice(i), math.MinInt16), math.MaxInt16))
+	}
+	for i := 0; i < len(out); i += rate / 50 {
+		g.Process(out[i:min(i+rate/50, len(out))])
+	}
+	return out
+}
+
+func TestGainControlLevelsSpeech(t *testing.T) {
+	const rate = 16000
+	for _, gain := range []float64{0.1, 1, 4} {
+		g := NewGainControl(rate, testGain)
+		out := talk(g, rate, 5, gain)
+		if got := level(out[len(out)-2*rate:]); math.Abs(got-testGain.Target) > 3 {
+			t.Errorf("speech at %.0f%% levelled to %.1f dBFS, want %.0f", gain*100, got, testGain.Target)
+		}
+	}
+}
+
+func TestGainControlLimitsPeaks(t *testing.T) {
+	const rate = 16000
+	g := NewGainControl(rate, testGain)
+	talk(g, rate, 3, 0.1) // quiet speech, the gain is high
+
+	burst := make([]int16, rate/50)
+	for i := range burst {
+		burst[i] = int16(20000 * math.Sin(float64(i)/3))
+	}
+	g.Process(burst)
+	ceiling := int16(math.Round(math.Pow(10, gainCeilingDB/20) * math.MaxInt16))
+	for i, v := range burst {
+		if v > ceiling || v < -ceiling {
+			t.Fatalf("sample %d is %d, above the %d ceiling", i, v, ceiling)
+		}
+	}
+}
+
+func TestGainControlHoldsGainInPauses(t *testing.T) {
+	const rate = 16000
+	g := NewGainControl(rate, testGain)
+	talk(g, rate, 3, 0.2)
+	before := g.Gain()
+
+	quiet := make([]int16, 2*rate)
+	for i := range quiet {
+		quiet[i] = int16(3 * math.Sin(float64(i)))
+	}
+	g.Process(quiet)
+	if after := g.Gain(); math.Abs(after-before) > 0.5 {
+		t.Errorf("gain moved from %.1f to %.1f dB during a pause", before, after)
+	}
+}
+
+func TestGainControlManual(t *testing.T) {
+	g := NewGainControl(8000, GainConfig{Manual: 6})
+	in := make([]int16, 800)
+	for i := range in {
+		in[i] = int16(1000 * math.Sin(float64(i)/4))
+	}
+	out := append([]int16(nil), in...)
+	g.Process(out[:400]) // the gain ramps up over the first block
+	g.Process(out[400:])
+	if got := level(out[400:]) - level(in[400:]); math.Abs(got-6) > 0.1 {
+		t.Errorf("manual gain of 6 dB applied %.2f dB", got)
+	}
+}
@@ -0,0 +1,180 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// noise suppression levels, from gentle to aggressive
+const (
+	NoiseLow = iota
+	NoiseModerate
+	NoiseHigh
+	NoiseVeryHigh
+)
+
+var (
+	noiseOversubtraction = [...]float64{1, 1.5, 2, 3}       // how much of the noise estimate is removed
+	noiseFloorDB         = [...]float64{-10, -15, -20, -25} // strongest attenuation of a bin
+)
+
+const (
+	noiseFrame      = 10 * time.Millisecond // rounded up to a power of two in samples, frames overlap by half
+	noiseSmoothing  = 0.8                   // of the power spectrum the noise is tracked on
+	noiseRise       = 1.002                 // per frame, the estimate follows rising noise slowly
+	noiseLearning   = 20                    // first frames averaged as noise before tracking minima
+	noiseDecisionDD = 0.98                  // weight of the previous frame in the a priori SNR, against musical noise
+)
+
+// NoiseSuppressor removes stationary noise such as fans and hum from mono audio. The noise spectrum
+// is the tracked minimum of the smoothed power spectrum, each bin is attenuated by a Wiener gain
+// on the a priori SNR, limited by a floor so the rest of the noise keeps its character.
+type NoiseSuppressor struct {
+	rate      int
+	size, hop int
+	window    []float64 // square root Hann, for analysis and synthesis
+	bypass    atomic.Bool
+	level     atomic.Int32
+
+	in    []float64 // input history, the newest frame is processed once it is complete
+	acc   []float64 // overlap add of the processed frames
+	out   []int16   // processed samples not returned yet
+	frame []complex128
+
+	smoothed, noise []float64 // power per bin
+	prevGain        []float64
+	prevSNR         []float64 // a posteriori SNR of the previous frame
+	frames          int
+}
+
+// NewNoiseSuppressor creates a suppressor for mono audio at rate, level is NoiseLow to NoiseVeryHigh
+func NewNoiseSuppressor(rate, level int) (*NoiseSuppressor, error) {
+	size := nextPow2(int(noiseFrame * time.Duration(rate) / time.Second))
+	ns := &NoiseSuppressor{
+		rate:     rate,
+		size:     size,
+		hop:      size / 2,
+		window:   make([]float64, size),
+		frame:    make([]complex128, size),
+		smoothed: make([]float64, size/2+1),
+		noise:    make([]float64, size/2+1),
+		prevGain: make([]float64, size/2+1),
+		prevSNR:  make([]float64, size/2+1),
+	}
+	if err := ns.SetLevel(level); err != nil {
+		return nil, err
+	}
+	for i := range ns.window {
+		ns.window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size)))
+	}
+	ns.reset()
+	return ns, nil
+}
+
+// SetLevel changes the aggressiveness, NoiseLow to NoiseVeryHigh
+func (ns *NoiseSuppressor) SetLevel(level int) error {
+	if level < NoiseLow || level > NoiseVeryHigh {
+		return fmt.Errorf("noise suppression level %d out of range %d-%d", level, NoiseLow, NoiseVeryHigh)
+	}
+	ns.level.Store(int32(level))
+	return nil
+}
+
+// SetBypass passes audio through untouched while set
+func (ns *NoiseSuppressor) SetBypass(bypass bool) {
+	ns.bypass.Store(bypass)
+}
+
+// Bypassed reports whether audio passes through untouched
+func (ns *NoiseSuppressor) Bypassed() bool {
+	return ns.bypass.Load()
+}
+
+// Latency is how late Process returns audio, one frame
+func (ns *NoiseSuppressor) Latency() time.Duration {
+	return time.Duration(ns.size) * time.Second / time.Duration(ns.rate)
+}
+
+// Process suppresses noise in samples in place
+func (ns *NoiseSuppressor) Process(samples []int16) {
+	if ns.bypass.Load() {
+		if ns.frames > 0 {
+			ns.reset() // learn the noise again when switched back on
+		}
+		return
+	}
+
+	for _, s := range samples {
+		ns.in = append(ns.in, float64(s))
+	}
+	processed := 0
+	for len(ns.in)-processed >= ns.size {
+		ns.processFrame(ns.in[processed : processed+ns.size])
+		processed += ns.hop
+	}
+	ns.in = append(ns.in[:0], ns.in[processed:]...)
+
+	n := copy(samples, ns.out)
+	ns.out = append(ns.out[:0], ns.out[n:]...)
+}
+
+// processFrame suppresses noise in one windowed frame and adds it to the output
+func (ns *NoiseSuppressor) processFrame(in []float64) {
+	for i, v := range in {
+		ns.frame[i] = complex(v*ns.window[i], 0)
+	}
+	fft(ns.frame, false)
+
+	level := ns.level.Load()
+	over, floor := noiseOversubtraction[level], math.Pow(10, noiseFloorDB[level]/20)
+	ns.frames++
+	for k := 0; k <= ns.size/2; k++ {
+		x := ns.frame[k]
+		power := real(x)*real(x) + imag(x)*imag(x)
+
+		ns.smoothed[k] = noiseSmoothing*ns.smoothed[k] + (1-noiseSmoothing)*power
+		switch {
+		case ns.frames <= noiseLearning:
+			ns.noise[k] += (ns.smoothed[k] - ns.noise[k]) / float64(ns.frames)
+		case ns.smoothed[k] < ns.noise[k]:
+			ns.noise[k] = ns.smoothed[k]
+		default:
+			ns.noise[k] *= noiseRise
+		}
+
+		noise := over*ns.noise[k] + 1e-9
+		snr := power / noise
+		prio := noiseDecisionDD*ns.prevGain[k]*ns.prevGain[k]*ns.prevSNR[k] + (1-noiseDecisionDD)*max(snr-1, 0)
+		gain := max(prio/(1+prio), floor)
+		ns.prevGain[k], ns.prevSNR[k] = gain, snr
+
+		ns.frame[k] *= complex(gain, 0)
+		if k > 0 && k < ns.size/2 {
+			ns.frame[ns.size-k] *= complex(gain, 0)
+		}
+	}
+	fft(ns.frame, true)
+
+	for i := range ns.acc {
+		ns.acc[i] += real(ns.frame[i]) * ns.window[i]
+	}
+	for _, v := range ns.acc[:ns.hop] {
+		ns.out = append(ns.out, int16(math.Round(min(max(v, math.MinInt16), math.MaxInt16))))
+	}
+	copy(ns.acc, ns.acc[ns.hop:])
+	clear(ns.acc[ns.size-ns.hop:])
+}
+
+// reset starts over with one frame of delay and no noise learned
+func (ns *NoiseSuppressor) reset() {
+	ns.in = make([]float64, ns.size-ns.hop)
+	ns.acc = make([]float64, ns.size)
+	ns.out = make([]int16, ns.hop)
+	clear(ns.smoothed)
+	clear(ns.noise)
+	clear(ns.prevGain)
+	clear(ns.prevSNR)
+	ns.frames = 0
+}
@@ -0,0 +1,96 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// noisy returns a tone starting after a second of white noise, and the tone alone
+func noisy(rate int, seconds float64, tone, noise float64) (in []int16, clean []float64) {
+	r := rand.New(rand.NewSource(3))
+	n := int(seconds * float64(rate))
+	in = make([]int16, n)
+	clean = make([]float64, n)
+	for i := range in {
+		if i >= rate {
+			clean[i] = tone * math.Sin(2*math.Pi*440*float64(i)/float64(rate))
+		}
+		in[i] = int16(clean[i] + noise*r.NormFloat64())
+	}
+	return in, clean
+}
+
+// suppress runs in through ns in 10 ms chunks and returns the output aligned with the input
+func suppress(ns *NoiseSuppressor, in []int16, rate int) []int16 {
+	out := append([]int16(nil), in...)
+	for i := 0; i+rate/100 <= len(out); i += rate / 100 {
+		ns.Process(out[i : i+rate/100])
+	}
+	latency := int(ns.Latency() * time.Duration(rate) / time.Second)
+	return out[latency:]
+}
+
+// snr of out against clean over the last second
+func snr(out []int16, clean []float64, rate int) float64 {
+	var signal, residual float64
+	for i := len(out) - rate; i < len(out); i++ {
+		d := float64(out[i]) - clean[i]
+		signal += clean[i] * clean[i]
+		residual += d * d
+	}
+	return 10 * math.Log10(signal/residual)
+}
+
+func TestNoiseSuppressorImprovesSNR(t *testing.T) {
+	const rate = 16000
+	in, clean := noisy(rate, 4, 2000, 1000)
+	before := snr(in, clean, rate)
+
+	ns, err := NewNoiseSuppressor(rate, NoiseModerate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := snr(suppress(ns, in, rate), clean, rate)
+	if after-before < 10 {
+		t.Errorf("SNR improved from %.1f to %.1f dB, want at least 10 dB better", before, after)
+	}
+}
+
+func TestNoiseSuppressorLevels(t *testing.T) {
+	const rate = 8000
+	in, _ := noisy(rate, 3, 0, 1000)
+
+	var last float64
+	for level := NoiseLow; level <= NoiseVeryHigh; level++ {
+		ns, err := NewNoiseSuppressor(rate, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := suppress(ns, in, rate)
+		reduction := 10 * math.Log10(energy(in[len(in)-rate:])/energy(out[len(out)-rate:]))
+		if reduction < -noiseFloorDB[level]-3 || reduction <= last {
+			t.Errorf("level %d reduces noise by %.1f dB, level %d by %.1f dB", level, reduction, level-1, last)
+		}
+		last = reduction
+	}
+	if _, err := NewNoiseSuppressor(rate, NoiseVeryHigh+1); err == nil {
+		t.Error("level out of range accepted")
+	}
+}
+
+func TestNoiseSuppressorBypass(t *testing.T) {
+	const rate = 8000
+	in, _ := noisy(rate, 1, 2000, 1000)
+	ns, _ := NewNoiseSuppressor(rate, NoiseHigh)
+	ns.SetBypass(true)
+
+	out := append([]int16(nil), in...)
+	ns.Process(out)
+	for i := range out {
+		if out[i] != in[i] {
+			t.Fatalf("sample %d changed to %d from %d", i, out[i], in[i])
+		}
+	}
+}
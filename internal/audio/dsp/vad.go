@@ -0,0 +1,138 @@
+package dsp
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	vadBlock         = 10 * time.Millisecond // analysed at once, rounded up to a power of two in samples
+	vadAboveNoise    = 6.0                   // dB over the noise floor a block needs to be voice
+	vadMinLevel      = -60.0                 // dBFS, quieter blocks are never voice
+	vadFlatness      = 0.35                  // spectral flatness below which a block is tonal, voiced speech is harmonic
+	vadSpeechBand    = 0.6                   // share of the power between 300 and 3400 Hz in speech
+	vadFloorFall     = 0.5                   // per block, how fast the noise floor follows quieter blocks
+	vadFloorRise     = 0.02                  // the same for louder blocks without voice
+	vadFloorRiseTalk = 0.002                 // and with voice, so steady noise taken for voice is learned eventually
+)
+
+// VoiceDetector tells speech from silence and background noise. A block is voice when it stands out
+// of the tracked noise floor and at least two of these hold: it is louder than the energy threshold,
+// its spectrum is tonal rather than flat, its power sits in the speech band. Voice lasts for the
+// hangover after the last voiced block so word endings and short pauses are kept.
+type VoiceDetector struct {
+	rate, channels int
+	threshold      float64 // RMS
+	hangover       time.Duration
+	block          int // mono samples
+	window         []float64
+	spectrum       []complex128
+	mono           []float64 // samples waiting for a whole block
+	floor          float64   // noise level in dBFS, starts quiet so the first words count
+	quietFor       time.Duration
+}
+
+// NewVoiceDetector creates a detector for interleaved audio. threshold is the RMS that counts as loud,
+// hangover how long voice lasts after it stops.
+func NewVoiceDetector(rate, channels int, threshold float64, hangover time.Duration) *VoiceDetector {
+	block := nextPow2(int(vadBlock * time.Duration(rate) / time.Second))
+	d := &VoiceDetector{
+		rate:      rate,
+		channels:  channels,
+		threshold: threshold,
+		hangover:  hangover,
+		block:     block,
+		window:    make([]float64, block),
+		spectrum:  make([]complex128, block),
+		floor:     vadMinLevel,
+		quietFor:  hangover + 1, // silent until voice is heard
+	}
+	for i := range d.window {
+		d.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(block))
+	}
+	return d
+}
+
+// Detect analyses the samples and reports whether voice was heard within the hangover
+func (d *VoiceDetector) Detect(samples []int16) bool {
+	for i := 0; i+d.channels <= len(samples); i += d.channels {
+		var sum float64
+		for c := range d.channels {
+			sum += float64(samples[i+c])
+		}
+		d.mono = append(d.mono, sum/float64(d.channels))
+	}
+
+	blockDuration := time.Duration(d.block) * time.Second / time.Duration(d.rate)
+	processed := 0
+	for len(d.mono)-processed >= d.block {
+		if d.analyse(d.mono[processed : processed+d.block]) {
+			d.quietFor = 0
+		} else {
+			d.quietFor += blockDuration
+		}
+		processed += d.block
+	}
+	d.mono = append(d.mono[:0], d.mono[processed:]...)
+	return d.quietFor <= d.hangover
+}
+
+// analyse decides whether one block is voice and updates the noise floor
+func (d *VoiceDetector) analyse(block []float64) bool {
+	var sum float64
+	for i, v := range block {
+		sum += v * v
+		d.spectrum[i] = complex(v*d.window[i], 0)
+	}
+	rms := math.Sqrt(sum / float64(len(block)))
+	level := dBFS(rms)
+
+	voice := false
+	if level >= vadMinLevel && level >= d.floor+vadAboveNoise {
+		flatness, speechShare := d.features()
+		features := 0
+		if rms >= d.threshold {
+			features++
+		}
+		if flatness < vadFlatness {
+			features++
+		}
+		if speechShare >= vadSpeechBand {
+			features++
+		}
+		voice = features >= 2
+	}
+
+	switch {
+	case level < d.floor:
+		d.floor += (level - d.floor) * vadFloorFall
+	case voice:
+		d.floor += (level - d.floor) * vadFloorRiseTalk
+	default:
+		d.floor += (level - d.floor) * vadFloorRise
+	}
+	return voice
+}
+
+// features returns the spectral flatness within the speech band and the share of power in it
+func (d *VoiceDetector) features() (flatness, speechShare float64) {
+	fft(d.spectrum, false)
+	binHz := float64(d.rate) / float64(d.block)
+	low, high := int(math.Ceil(300/binHz)), min(int(3400/binHz), d.block/2)
+
+	var total, band, logSum float64
+	for k := 1; k <= d.block/2; k++ {
+		x := d.spectrum[k]
+		power := real(x)*real(x) + imag(x)*imag(x) + 1e-9
+		total += power
+		if k >= low && k <= high {
+			band += power
+			logSum += math.Log(power)
+		}
+	}
+	bins := float64(high - low + 1)
+	if bins <= 0 || band == 0 {
+		return 1, 0
+	}
+	return math.Exp(logSum/bins) / (band / bins), band / total
+}
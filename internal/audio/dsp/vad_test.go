@@ -0,0 +1,100 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// voiced is harmonic speech at a 140 Hz pitch, talking while talk(i) is set, over white noise
+func voiced(rate int, amplitude, noise float64, talk func(i int) bool) func(i int) float64 {
+	r := rand.New(rand.NewSource(4))
+	return func(i int) float64 {
+		v := noise * r.NormFloat64()
+		if talk(i) {
+			t := float64(i) / float64(rate)
+			for h := 1; h <= 20; h++ {
+				formant := math.Exp(-math.Abs(float64(h)*140-700) / 800)
+				v += amplitude * formant * math.Sin(2*math.Pi*140*float64(h)*t+float64(h))
+			}
+		}
+		return v
+	}
+}
+
+// detect runs seconds of signal through d in 20 ms frames and returns the decision per frame
+func detect(d *VoiceDetector, rate int, seconds float64, signal func(i int) float64) []bool {
+	frame := rate / 50
+	var decisions []bool
+	for start := 0; start+frame <= int(seconds*float64(rate)); start += frame {
+		samples := make([]int16, frame)
+		for i := range samples {
+			samples[i] = int16(signal(start + i))
+		}
+		decisions = append(decisions, d.Detect(samples))
+	}
+	return decisions
+}
+
+func share(decisions []bool, want bool) float64 {
+	n := 0
+	for _, d := range decisions {
+		if d == want {
+			n++
+		}
+	}
+	return float64(n) / float64(len(decisions))
+}
+
+func TestVoiceDetectorFindsSpeechInNoise(t *testing.T) {
+	for _, rate := range []int{8000, 16000, 48000} {
+		// one second of noise, then half a second of talking and half a second of pause
+		talk := func(i int) bool { return i >= rate && (i/(rate/2))%2 == 0 }
+		d := NewVoiceDetector(rate, 1, 500, 100*time.Millisecond)
+		decisions := detect(d, rate, 6, voiced(rate, 1500, 300, talk))
+
+		var talking, pausing []bool
+		for f, decision := range decisions {
+			i := f * rate / 50
+			switch {
+			case i < rate:
+			case talk(i):
+				talking = append(talking, decision)
+			case !talk(i - 150*rate/1000): // past the hangover
+				pausing = append(pausing, decision)
+			}
+		}
+		if got := share(talking, true); got < 0.9 {
+			t.Errorf("%d Hz: voice found in %.0f%% of speech, want 90%%", rate, got*100)
+		}
+		if got := share(pausing, false); got < 0.9 {
+			t.Errorf("%d Hz: silence found in %.0f%% of pauses, want 90%%", rate, got*100)
+		}
+	}
+}
+
+func TestVoiceDetectorIgnoresSteadyNoise(t *testing.T) {
+	const rate = 16000
+	d := NewVoiceDetector(rate, 1, 500, 200*time.Millisecond)
+	// loud enough to pass the energy threshold, flat and broadband
+	decisions := detect(d, rate, 4, voiced(rate, 0, 2000, func(int) bool { return false }))
+	if got := share(decisions[50:], false); got < 0.95 {
+		t.Errorf("noise taken for silence in %.0f%% of frames, want 95%%", got*100)
+	}
+}
+
+func TestVoiceDetectorHangover(t *testing.T) {
+	const rate = 16000
+	d := NewVoiceDetector(rate, 1, 500, 200*time.Millisecond)
+	talk := func(i int) bool { return i >= rate && i < 2*rate }
+	decisions := detect(d, rate, 3, voiced(rate, 1500, 50, talk))
+
+	// frames of 20 ms, speech ends at frame 100
+	if !decisions[105] {
+		t.Error("voice ended within the hangover")
+	}
+	if decisions[115] {
+		t.Error("voice lasted past the hangover")
+	}
+}
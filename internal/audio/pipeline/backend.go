@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"errors"
+	"p2p-call/internal/audio/capture"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/device"
+	"p2p-call/internal/audio/playback"
+	appconfig "p2p-call/pkg/config"
+	"time"
+)
+
+var ErrNoFile = errors.New("file backend needs a file path")
+
+// CaptureSource produces the encoded frames that are sent to the peer
+type CaptureSource interface {
+	Frames() <-chan capture.Frame
+	SetPaused(paused bool) // mute
+	Paused() bool
+	Talking() bool          // voice detected on the microphone, also while muted
+	Suspend(suspended bool) // hold, independent of mute
+	SetHoldSource(source func(samples []int16))
+	SampleRate() (rate, channels int)
+	SetFrameDuration(d time.Duration) error
+	FrameDuration() time.Duration
+	Latency() (device, accumulation time.Duration)
+	Chain() *chain.Chain // processing stages between capture and sending
+	Close()
+}
+
+// PlaybackSink decodes and plays the packets received from the peer
+type PlaybackSink interface {
+	Packets() chan<- []byte
+	SetPaused(paused bool)
+	Paused() bool
+	SetComfortNoiseLevel(level uint8)
+	StartTalkspurt() // the next packet starts speech after suppressed silence
+	Buffered() time.Duration
+	Concealment() (concealed, played uint64)
+	DevicePeriod() time.Duration
+	SetMonitor(monitor func(samples []int16)) // sees all audio about to be played
+	Chain() *chain.Chain                      // processing stages between receiving and playing
+	Close()
+}
+
+// DeviceSwitcher is implemented by backends that use a sound card
+type DeviceSwitcher interface {
+	SwitchDevice(selector string) error // by device id or part of its name, empty for the default
+	OnDeviceChange(handler func(device.Change))
+}
+
+// OpenCapture creates and starts the configured capture backend
+func OpenCapture(audiocfg config.AudioConfig, backends appconfig.AudioBackendConfig) (CaptureSource, error) {
+	switch backends.Input {
+	case appconfig.AudioBackendNull:
+		return capture.NewNullCapture(audiocfg), nil
+	case appconfig.AudioBackendFile:
+		if backends.InputFile == "" {
+			return nil, ErrNoFile
+		}
+		return capture.NewFileCapture(audiocfg, backends.InputFile, backends.InputLoop)
+	}
+
+	mc, err := capture.NewMalgoCapture(audiocfg, backends.InputDevice, backends.InputFallback)
+	if err != nil {
+		return nil, err
+	}
+	if err := mc.StartMalgoCapture(); err != nil {
+		mc.Close()
+		return nil, err
+	}
+	return mc, nil
+}
+
+// OpenPlayback creates and starts the configured playback backend
+func OpenPlayback(audiocfg config.AudioConfig, backends appconfig.AudioBackendConfig) (PlaybackSink, error) {
+	switch backends.Output {
+	case appconfig.AudioBackendNull:
+		return playback.NewNullPlayback(audiocfg), nil
+	case appconfig.AudioBackendFile:
+		if backends.OutputFile == "" {
+			return nil, ErrNoFile
+		}
+		return playback.NewFilePlayback(audiocfg, backends.OutputFile)
+	}
+
+	mp, err := playback.NewMalgoPlayback(audiocfg, backends.OutputDevice, backends.OutputFallback)
+	if err != nil {
+		return nil, err
+	}
+	if err := mp.StartMalgoPlayback(); err != nil {
+		mp.Close()
+		return nil, err
+	}
+	return mp, nil
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"p2p-call/internal/audio/capture"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/codec/pcmu"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/playback"
+	appconfig "p2p-call/pkg/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+func pcmuConfig() config.AudioConfig {
+	cfg := config.NewPCMUConfig()
+	cfg.Encoder = pcmu.NewPCMUEncoder()
+	cfg.Decoder = pcmu.NewPCMUDecoder()
+	return cfg
+}
+
+func TestMemoryBackendsRoundTrip(t *testing.T) {
+	cfg := pcmuConfig()
+	var source CaptureSource = capture.NewMemoryCapture(cfg)
+	defer source.Close()
+	sink := playback.NewMemoryPlayback(cfg)
+	defer sink.Close()
+	source.SetPaused(false)
+	sink.SetPaused(false)
+
+	// square wave, loud enough to survive mu-law and the silence detector
+	samples := make([]int16, cfg.FrameSamples)
+	for i := range samples {
+		samples[i] = 8000
+		if i/10%2 == 0 {
+			samples[i] = -8000
+		}
+	}
+	source.(*capture.MemoryCapture).Write(samples)
+
+	frame := <-source.Frames()
+	if len(frame.Data) != cfg.FrameSamples || frame.Silent {
+		t.Fatalf("got %d byte frame silent=%v, want %d bytes of speech", len(frame.Data), frame.Silent, cfg.FrameSamples)
+	}
+
+	var output PlaybackSink = sink
+	output.Packets() <- frame.Data
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case played := <-sink.Out:
+			for _, sample := range played {
+				if sample > 7000 || sample < -7000 {
+					return
+				}
+			}
+		case <-deadline:
+			t.Fatal("received audio was never played")
+		}
+	}
+}
+
+func TestResampleRunsBeforeRateDependentStages(t *testing.T) {
+	cfg := pcmuConfig()
+	cfg.CaptureChain = []string{config.StageAEC, config.StageResample, config.StageEncode}
+	cfg.PlaybackChain = []string{config.StageResample, config.StageGain, config.StageDecode}
+	source := capture.NewMemoryCapture(cfg)
+	defer source.Close()
+	sink := playback.NewMemoryPlayback(cfg)
+	defer sink.Close()
+
+	for _, tc := range []struct {
+		stats []chain.StageStats
+		want  []string
+	}{
+		{source.Chain().Stats(), []string{config.StageResample, config.StageAEC, config.StageEncode}},
+		{sink.Chain().Stats(), []string{config.StageDecode, config.StageResample, config.StageGain}},
+	} {
+		var got []string
+		for _, stage := range tc.stats {
+			got = append(got, stage.Name)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("stages %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestOpenFileBackendNeedsPath(t *testing.T) {
+	cfg := pcmuConfig()
+	if _, err := OpenCapture(cfg, appconfig.AudioBackendConfig{Input: appconfig.AudioBackendFile, Output: appconfig.AudioBackendFile}); err != ErrNoFile {
+		t.Errorf("OpenCapture without file = %v, want ErrNoFile", err)
+	}
+	if _, err := OpenPlayback(cfg, appconfig.AudioBackendConfig{Input: appconfig.AudioBackendFile, Output: appconfig.AudioBackendFile}); err != ErrNoFile {
+		t.Errorf("OpenPlayback without file = %v, want ErrNoFile", err)
+	}
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"p2p-call/internal/audio/capture"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/rtc/track"
+	"time"
+)
+
+const (
+	cnRefreshInterval = 500 * time.Millisecond // resend comfort noise level even if unchanged
+	cnLevelChange     = 3                      // dB change that triggers a comfort noise update
+)
+
+// dtxState tracks suppressed silence on the sending side: when RFC 3389 comfort noise
+// packets are due and whether the next speech packet starts a talkspurt
+type dtxState struct {
+	inSilence bool
+	lastLevel uint8
+	sinceCN   time.Duration
+}
+
+func newDTXState() *dtxState {
+	return &dtxState{}
+}
+
+// silentSample returns what to send in place of a silent frame: a comfort noise packet when one
+// is due, otherwise an empty sample that only advances the RTP clock
+func (d *dtxState) silentSample(frame capture.Frame, cnNegotiated bool) track.Sample {
+	sample := track.Sample{Duration: frame.Duration}
+	d.sinceCN += frame.Duration
+
+	levelDiff := int(frame.Level) - int(d.lastLevel)
+	due := !d.inSilence || d.sinceCN >= cnRefreshInterval || levelDiff >= cnLevelChange || levelDiff <= -cnLevelChange
+	if cnNegotiated && due {
+		sample.MimeType = config.MimeTypeCN
+		sample.Data = []byte{frame.Level & 0x7f} // noise level in -dBov, no spectral data
+		d.sinceCN = 0
+		d.lastLevel = frame.Level
+	}
+	d.inSilence = true
+	return sample
+}
+
+// talkspurtStart reports whether a speech frame is the first after suppressed silence,
+// such packets carry the RTP marker bit
+func (d *dtxState) talkspurtStart() bool {
+	start := d.inSilence
+	d.inSilence = false
+	return start
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"math"
+	"p2p-call/internal/audio/capture"
+	"p2p-call/internal/audio/config"
+	"testing"
+	"time"
+)
+
+func TestQuietFramesSilentAfterHangover(t *testing.T) {
+	cfg := pcmuConfig()
+	cfg.DTXHangover = 100 * time.Millisecond
+	source := capture.NewMemoryCapture(cfg)
+	defer source.Close()
+	source.SetPaused(false)
+
+	tone := make([]int16, cfg.FrameSamples)
+	for i := range tone {
+		tone[i] = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(cfg.SampleRate)))
+	}
+	quiet := make([]int16, cfg.FrameSamples) // far below the energy threshold
+	next := func(samples []int16) capture.Frame {
+		t.Helper()
+		source.Write(samples)
+		select {
+		case frame := <-source.Frames():
+			return frame
+		case <-time.After(time.Second):
+			t.Fatal("no frame captured")
+			return capture.Frame{}
+		}
+	}
+
+	for i := range 25 {
+		if frame := next(tone); i >= 5 && frame.Silent {
+			t.Fatalf("speech frame %d flagged silent", i)
+		}
+	}
+	// frames of 20 ms, the hangover covers the first five quiet ones
+	for i := range 15 {
+		frame := next(quiet)
+		switch {
+		case i < 3 && frame.Silent:
+			t.Errorf("quiet frame %d flagged silent within the hangover", i)
+		case i >= 8 && !frame.Silent:
+			t.Errorf("quiet frame %d not flagged silent after the hangover", i)
+		}
+	}
+}
+
+func TestComfortNoiseInterval(t *testing.T) {
+	const frame = 20 * time.Millisecond
+	d := newDTXState()
+	var sentAt []int
+	level := uint8(60)
+	for i := range 60 {
+		if i == 40 {
+			level = 60 - cnLevelChange // louder background is announced at once
+		}
+		sample := d.silentSample(capture.Frame{Duration: frame, Level: level, Silent: true}, true)
+		if sample.Duration != frame {
+			t.Fatalf("silent sample %d advances the clock by %v, want %v", i, sample.Duration, frame)
+		}
+		if sample.Data == nil {
+			continue
+		}
+		if sample.MimeType != config.MimeTypeCN || len(sample.Data) != 1 || sample.Data[0] != level {
+			t.Fatalf("comfort noise packet %d = %s %v, want level %d", i, sample.MimeType, sample.Data, level)
+		}
+		sentAt = append(sentAt, i)
+	}
+
+	// first silent frame, every 500 ms after, then the level change
+	want := []int{0, 25, 40}
+	if len(sentAt) != len(want) {
+		t.Fatalf("comfort noise sent at frames %v, want %v", sentAt, want)
+	}
+	for i := range want {
+		if sentAt[i] != want[i] {
+			t.Fatalf("comfort noise sent at frames %v, want %v", sentAt, want)
+		}
+	}
+
+	if !d.talkspurtStart() || d.talkspurtStart() {
+		t.Error("only the first speech frame after silence starts a talkspurt")
+	}
+	if sample := d.silentSample(capture.Frame{Duration: frame, Level: level}, false); sample.Data != nil {
+		t.Error("comfort noise sent without negotiating it")
+	}
+}
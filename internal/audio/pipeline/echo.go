@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"log"
+	"p2p-call/internal/audio/capture"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/playback"
+	"time"
+)
+
+// NewEchoPipeline creates a pipeline without sound devices that sends received audio back after delay.
+// playback -> delay -> capture
+func NewEchoPipeline(audiocfg config.AudioConfig, delay time.Duration) *AudioPipeline {
+	capture := capture.NewMemoryCapture(audiocfg)
+	capture.SetPaused(false)
+	playback := playback.NewMemoryPlayback(audiocfg)
+	playback.SetPaused(false)
+
+	delayed := int(delay*time.Duration(audiocfg.SampleRate)/time.Second) * int(audiocfg.Channels)
+	line := newDelayLine(delayed)
+	go func() {
+		for samples := range playback.Out {
+			capture.Write(line.process(samples))
+		}
+	}()
+	log.Printf("Echo pipeline started, delay %v", delay)
+
+	return NewAudioPipelineWith(audiocfg, capture, playback)
+}
+
+// delayLine holds samples back by a fixed count, starting with silence
+type delayLine struct {
+	buf []int16
+}
+
+func newDelayLine(samples int) *delayLine {
+	return &delayLine{buf: make([]int16, samples)}
+}
+
+// process queues in and returns as many samples, the ones queued the delay ago
+func (d *delayLine) process(in []int16) []int16 {
+	d.buf = append(d.buf, in...)
+	out := d.buf[:len(in):len(in)]
+	d.buf = d.buf[len(in):]
+	return out
+}
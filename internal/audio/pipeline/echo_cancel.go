@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/dsp"
+	"time"
+)
+
+// EnableEchoCancellation removes what the speaker plays from the microphone signal before it
+// is encoded. tail is how long the room keeps echoing, maxDelay the longest speaker to microphone
+// delay searched for. Only mono audio is supported.
+func (p *AudioPipeline) EnableEchoCancellation(tail, maxDelay time.Duration) error {
+	rate, channels := p.Capture.SampleRate()
+	if channels != 1 {
+		return fmt.Errorf("echo cancellation needs mono audio, capture has %d channels", channels)
+	}
+	ec := dsp.NewEchoCanceller(rate, tail, maxDelay)
+	if err := p.Capture.Chain().Register(chain.Stage{Name: config.StageAEC, Process: processPCM(ec.Process), Delay: ec.Latency()}); err != nil {
+		return err
+	}
+	p.Playback.SetMonitor(ec.Reference)
+	p.echo.Store(ec)
+	log.Printf("Echo cancellation enabled (tail %v, delay up to %v)", tail, maxDelay)
+	return nil
+}
+
+// EchoStats returns the state of the echo canceller, ok is false when it is off
+func (p *AudioPipeline) EchoStats() (stats dsp.EchoStats, ok bool) {
+	ec := p.echo.Load()
+	if ec == nil {
+		return dsp.EchoStats{}, false
+	}
+	return ec.Stats(), true
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDelayLine(t *testing.T) {
+	line := newDelayLine(3)
+
+	if got := line.process([]int16{1, 2}); !slices.Equal(got, []int16{0, 0}) {
+		t.Fatalf("first block = %v, want silence", got)
+	}
+	if got := line.process([]int16{3, 4}); !slices.Equal(got, []int16{0, 1}) {
+		t.Fatalf("second block = %v, want [0 1]", got)
+	}
+	if got := line.process([]int16{5, 6, 7}); !slices.Equal(got, []int16{2, 3, 4}) {
+		t.Fatalf("third block = %v, want [2 3 4]", got)
+	}
+}
+
+func TestDelayLineWithoutDelay(t *testing.T) {
+	line := newDelayLine(0)
+	if got := line.process([]int16{1, 2}); !slices.Equal(got, []int16{1, 2}) {
+		t.Fatalf("got %v, want input unchanged", got)
+	}
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"log"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/dsp"
+)
+
+// EnableGainControl levels the microphone signal before it is encoded.
+// The limiter keeps peaks from clipping in either mode.
+func (p *AudioPipeline) EnableGainControl(cfg dsp.GainConfig) error {
+	rate, channels := p.Capture.SampleRate()
+	g := dsp.NewGainControl(rate*channels, cfg) // interleaved channels share the gain
+	if err := p.Capture.Chain().Register(chain.Stage{Name: config.StageAGC, Process: processPCM(g.Process)}); err != nil {
+		return err
+	}
+	p.gain.Store(g)
+	if cfg.Automatic {
+		log.Printf("Automatic gain control enabled (target %.0f dBFS, up to %.0f dB)", cfg.Target, cfg.MaxGain)
+	} else {
+		log.Printf("Input gain %+.0f dB", cfg.Manual)
+	}
+	return nil
+}
+
+// SetAutomaticGain switches between automatic gain control and the manual input gain, ok is false
+// when gain control was never enabled
+func (p *AudioPipeline) SetAutomaticGain(automatic bool) (ok bool) {
+	g := p.gain.Load()
+	if g == nil {
+		return false
+	}
+	g.SetAutomatic(automatic)
+	return true
+}
+
+// SetInputGain turns automatic gain control off and applies dB of fixed gain, ok is false when
+// gain control was never enabled
+func (p *AudioPipeline) SetInputGain(dB float64) (ok bool) {
+	g := p.gain.Load()
+	if g == nil {
+		return false
+	}
+	g.SetManualGain(dB)
+	g.SetAutomatic(false)
+	return true
+}
+
+// InputGain returns the gain applied to the microphone and whether it is automatic, ok is false
+// when gain control was never enabled
+func (p *AudioPipeline) InputGain() (dB float64, automatic, ok bool) {
+	g := p.gain.Load()
+	if g == nil {
+		return 0, false, false
+	}
+	return g.Gain(), g.Automatic(), true
+}
@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/dsp"
+)
+
+// EnableNoiseSuppression removes stationary background noise from the microphone signal before it
+// is encoded. level is dsp.NoiseLow to dsp.NoiseVeryHigh. Only mono audio is supported.
+func (p *AudioPipeline) EnableNoiseSuppression(level int) error {
+	rate, channels := p.Capture.SampleRate()
+	if channels != 1 {
+		return fmt.Errorf("noise suppression needs mono audio, capture has %d channels", channels)
+	}
+	ns, err := dsp.NewNoiseSuppressor(rate, level)
+	if err != nil {
+		return err
+	}
+	// the suppressor bypasses itself so it learns the noise again when switched back on
+	stage := chain.Stage{Name: config.StageNS, Process: processPCM(ns.Process), Bypass: ns.SetBypass, Delay: ns.Latency()}
+	if err := p.Capture.Chain().Register(stage); err != nil {
+		return err
+	}
+	log.Printf("Noise suppression enabled (level %d)", level)
+	return nil
+}
+
+// SetNoiseSuppression switches noise suppression on or off during a call, ok is false when it was never enabled
+func (p *AudioPipeline) SetNoiseSuppression(on bool) (ok bool) {
+	if _, registered := p.Capture.Chain().Bypassed(config.StageNS); !registered {
+		return false
+	}
+	return p.Capture.Chain().SetBypass(config.StageNS, !on) == nil
+}
+
+// NoiseSuppression reports whether noise suppression is on, ok is false when it was never enabled
+func (p *AudioPipeline) NoiseSuppression() (on, ok bool) {
+	bypassed, registered := p.Capture.Chain().Bypassed(config.StageNS)
+	return !bypassed, registered
+}
@@ -4,109 +4,140 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"p2p-call/internal/audio/capture"
 	"p2p-call/internal/audio/codec/iface"
+	"p2p-call/internal/audio/codec/red"
 	"p2p-call/internal/audio/config"
-	"p2p-call/internal/audio/playback"
+	"p2p-call/internal/audio/dsp"
+	"p2p-call/internal/metrics"
+	"p2p-call/internal/rtc/track"
+	appconfig "p2p-call/pkg/config"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
-	"github.com/pion/webrtc/v4/pkg/media"
 )
 
-// AddOnPipe adds a processing function to the pipeline.
-// q - quit channel to stop the processing
-// f - processing function
-// in - input channel
-// chanBuffer - buffer size for the output channel
-// returns output channel (можно добвалять доп обработку по кодированию напрмиер)
-func AddOnPipe[X, Y any](q <-chan struct{}, f func(X) Y, in <-chan X, chanBuffer int) chan Y {
-	out := make(chan Y, chanBuffer)
-	go func() {
-		defer close(out)
-		for {
-			select {
-			case <-q:
-				return
-			case data, ok := <-in:
-				if !ok {
-					return
-				}
-				result := f(data)
-				select {
-				case out <- result:
-				default: // if out channel is full, drop the data
-					log.Println("Dropping data in pipeline stage")
-				}
-			}
-		}
-
-	}()
-	return out
-}
-
 var (
 	ErrEncoderNil = errors.New("encoder cannot be nil")
 	ErrDecoderNil = errors.New("decoder cannot be nil")
 )
 
 type AudioPipeline struct {
-	Capture  *capture.MalgoCapture
-	Playback *playback.MalgoPlayback
+	Capture  CaptureSource
+	Playback PlaybackSink
 	encoder  iface.Encoder
 	decoder  iface.Decoder
 
+	mimeType   string
+	clockRate  uint32
+	dtx        bool
+	redundancy atomic.Int32 // previous frames carried in RED packets, 0 sends plain frames
+	onDTMF     atomic.Pointer[func(digit rune)]
+	speaking   speakingTracker
+	arrival    atomic.Pointer[Arrival] // newest packet received
+	echo       atomic.Pointer[dsp.EchoCanceller]
+	gain       atomic.Pointer[dsp.GainControl]
+
 	QuitSend chan struct{}
 	QuitRecv chan struct{}
 }
 
-func NewAudioPipeline(audiocfg config.AudioConfig) (*AudioPipeline, error) {
+// Arrival is the RTP timestamp of a received packet and when it arrived
+type Arrival struct {
+	Timestamp uint32
+	At        time.Time
+}
+
+// NewAudioPipeline opens the configured capture and playback backends
+func NewAudioPipeline(audiocfg config.AudioConfig, backends appconfig.AudioBackendConfig) (*AudioPipeline, error) {
 
 	// create capture
-	capture, err := capture.NewMalgoCapture(audiocfg)
+	capture, err := OpenCapture(audiocfg, backends)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := capture.StartMalgoCapture(); err != nil {
-		return nil, err
-	}
-
 	// create playback
-	playback, err := playback.NewMalgoPlayback(audiocfg)
+	playback, err := OpenPlayback(audiocfg, backends)
 	if err != nil {
+		capture.Close()
 		return nil, err
 	}
-	if err := playback.StartMalgoPlayback(); err != nil {
-		return nil, err
+
+	return NewAudioPipelineWith(audiocfg, capture, playback), nil
+}
+
+// NewAudioPipelineWith creates a pipeline over backends that are already running
+func NewAudioPipelineWith(audiocfg config.AudioConfig, capture CaptureSource, playback PlaybackSink) *AudioPipeline {
+	return &AudioPipeline{
+		Capture:   capture,
+		Playback:  playback,
+		encoder:   audiocfg.Encoder,
+		decoder:   audiocfg.Decoder,
+		mimeType:  strings.ToLower(audiocfg.MimeType),
+		clockRate: audiocfg.SampleRate,
+		dtx:       audiocfg.DTX,
+		QuitSend:  make(chan struct{}),
+		QuitRecv:  make(chan struct{}),
 	}
+}
 
-	ap := &AudioPipeline{
-		Capture:  capture,
-		Playback: playback,
-		encoder:  audiocfg.Encoder,
-		decoder:  audiocfg.Decoder,
-		QuitSend: make(chan struct{}),
-		QuitRecv: make(chan struct{}),
+// SetRedundancy sets how many previous frames ride along every packet, 0 disables RED.
+// Has no effect unless the remote peer accepted audio/red.
+func (p *AudioPipeline) SetRedundancy(distance int) {
+	if old := p.redundancy.Swap(int32(distance)); old != int32(distance) {
+		log.Printf("Redundant audio distance changed %d -> %d", old, distance)
 	}
-	return ap, nil
 }
 
 // StartSending starts the audio capture, encoding, and sending process.
-// capture -> encode -> send
-func (p *AudioPipeline) StartSending(track *webrtc.TrackLocalStaticSample) {
+// capture -> encode -> (dtx / red) -> send
+func (p *AudioPipeline) StartSending(audioTrack *track.AudioTrack) {
 	defer log.Println("Sending pipeline stopped")
-	const duration = time.Millisecond * 20
+	redEncoder := red.NewEncoder()
+	dtx := newDTXState()
 
 	for {
 		select {
 		case <-p.QuitSend:
 			return
-		case encoded, ok := <-p.Capture.PcmChan:
+		case frame, ok := <-p.Capture.Frames():
 			if !ok {
 				return
 			}
-			if err := track.WriteSample(media.Sample{Data: encoded, Duration: duration}); err != nil {
+			samples := uint32(frame.Duration * time.Duration(p.clockRate) / time.Second)
+
+			// the encoder may skip a frame on its own (opus DTX), it can't be sent either way
+			if (p.dtx && frame.Silent) || len(frame.Data) == 0 {
+				redEncoder.Push(nil, samples)
+				_, cnNegotiated := audioTrack.PayloadType(config.MimeTypeCN)
+				if err := audioTrack.WriteSample(dtx.silentSample(frame, cnNegotiated)); err != nil {
+					log.Printf("Error writing comfort noise: %v", err)
+					return
+				}
+				continue
+			}
+
+			sample := track.Sample{
+				Data:       frame.Data,
+				Duration:   frame.Duration,
+				Marker:     dtx.talkspurtStart(),
+				AudioLevel: levelExtension(frame),
+			}
+
+			_, redNegotiated := audioTrack.PayloadType(config.MimeTypeRED)
+			if distance := int(p.redundancy.Load()); distance > 0 && redNegotiated {
+				primaryType, _ := audioTrack.PayloadType("")
+				sample.Data = redEncoder.Encode(primaryType, frame.Data, samples, distance)
+				sample.MimeType = config.MimeTypeRED
+			} else {
+				redEncoder.Push(frame.Data, samples) // keep history so redundancy starts with full blocks
+			}
+
+			if err := audioTrack.WriteSample(sample); err != nil {
 				log.Printf("Error writing audio sample: %v", err)
 				return
 			}
@@ -117,13 +148,25 @@ func (p *AudioPipeline) StartSending(track *webrtc.TrackLocalStaticSample) {
 }
 
 // StartReceiving starts the audio receiving, decoding, and playback process.
-// receive -> decode -> playback
-func (p *AudioPipeline) StartReceiving(track *webrtc.TrackRemote) {
+// receive -> (red recovery) -> decode -> playback
+// params are the negotiated receive parameters used to tell payload types and header extensions apart.
+func (p *AudioPipeline) StartReceiving(remote *webrtc.TrackRemote, params webrtc.RTPParameters) {
 	log.Println("Processing incoming audio stream...")
 	defer log.Println("Receiving pipeline stoppped")
-	trackKind := track.Kind().String()
-	trackID := track.ID()
-	streamID := track.StreamID()
+	trackKind := remote.Kind().String()
+	trackID := remote.ID()
+	streamID := remote.StreamID()
+
+	payloadTypes := make(map[uint8]string, len(params.Codecs))
+	for _, codec := range params.Codecs {
+		payloadTypes[uint8(codec.PayloadType)] = strings.ToLower(codec.MimeType)
+	}
+	audioLevelID := track.HeaderExtensionID(params.HeaderExtensions, sdp.AudioLevelURI)
+
+	var lastTimestamp uint32 // timestamp of the newest frame handed to playback
+	started := false
+	var lastEvent uint32 // timestamp of the last telephone event reported
+	eventSeen := false
 
 	log.Printf("Track info: Kind=%s, ID=%s, StreamID=%s", trackKind, trackID, streamID)
 	for {
@@ -131,22 +174,122 @@ func (p *AudioPipeline) StartReceiving(track *webrtc.TrackRemote) {
 		case <-p.QuitRecv:
 			return
 		default:
-			rtp, _, err := track.ReadRTP()
+			packet, _, err := remote.ReadRTP()
 			if err != nil {
 				log.Printf("Error reading RTP: %v", err)
 				return
 			}
-			select {
-			case p.Playback.InChan <- rtp.Payload:
-			default:
-				log.Println("RTP channel full, dropping packet")
+
+			if audioLevelID != 0 {
+				p.updateSpeaking(packet, audioLevelID)
 			}
 
+			payloads := [][]byte{packet.Payload}
+			switch payloadTypes[packet.PayloadType] {
+			case config.MimeTypeRED:
+				payloads = p.recoverRed(packet, payloadTypes, lastTimestamp, started)
+			case strings.ToLower(config.MimeTypeCN):
+				if len(packet.Payload) > 0 {
+					p.Playback.SetComfortNoiseLevel(packet.Payload[0] & 0x7f)
+				}
+				continue
+			case track.MimeTypeTelephoneEvent:
+				// every event is sent as several packets sharing one timestamp
+				if !eventSeen || packet.Timestamp != lastEvent {
+					p.handleEvent(packet.Payload)
+					lastEvent = packet.Timestamp
+					eventSeen = true
+				}
+				continue
+			}
+			if packet.Marker {
+				p.Playback.StartTalkspurt()
+			}
+			if !started || int32(packet.Timestamp-lastTimestamp) > 0 {
+				lastTimestamp = packet.Timestamp
+				started = true
+				p.arrival.Store(&Arrival{Timestamp: packet.Timestamp, At: time.Now()})
+			}
+
+			for _, payload := range payloads {
+				select {
+				case p.Playback.Packets() <- payload:
+				default:
+					log.Println("RTP channel full, dropping packet")
+					metrics.PipelineDrop("receive")
+				}
+			}
 		}
 	}
 
 }
 
+// recoverRed unwraps a RED packet. Redundant blocks are returned only when they are newer than
+// the last frame played, which means the packets that carried them originally were lost.
+func (p *AudioPipeline) recoverRed(packet *rtp.Packet, payloadTypes map[uint8]string, lastTimestamp uint32, started bool) [][]byte {
+	blocks, err := red.Decode(packet.Payload)
+	if err != nil {
+		log.Printf("Failed to unwrap RED packet: %v", err)
+		return nil
+	}
+
+	payloads := make([][]byte, 0, len(blocks))
+	for _, block := range blocks {
+		if payloadTypes[block.PayloadType] != p.mimeType {
+			continue
+		}
+		if block.TimestampOffset > 0 {
+			blockTimestamp := packet.Timestamp - block.TimestampOffset
+			if !started || int32(blockTimestamp-lastTimestamp) <= 0 {
+				continue
+			}
+		}
+		payloads = append(payloads, block.Data)
+	}
+	return payloads
+}
+
+// updateSpeaking reads the audio level header extension of an incoming packet
+func (p *AudioPipeline) updateSpeaking(packet *rtp.Packet, audioLevelID uint8) {
+	raw := packet.GetExtension(audioLevelID)
+	if raw == nil {
+		return
+	}
+	var level rtp.AudioLevelExtension
+	if err := level.Unmarshal(raw); err != nil {
+		return
+	}
+	p.speaking.update(level.Level, level.Voice, time.Now())
+}
+
+// RemoteLevel returns the remote audio level in -dBov (127 is silence) and whether the remote side is talking
+func (p *AudioPipeline) RemoteLevel() (level uint8, speaking bool) {
+	return p.speaking.state(time.Now())
+}
+
+// LastArrival returns the newest audio packet received, nil before any arrived
+func (p *AudioPipeline) LastArrival() *Arrival {
+	return p.arrival.Load()
+}
+
+// handleEvent reports a remote DTMF digit
+func (p *AudioPipeline) handleEvent(payload []byte) {
+	event, err := track.ParseEvent(payload)
+	if err != nil {
+		log.Printf("Ignoring telephone event: %v", err)
+		return
+	}
+	log.Printf("Received DTMF digit %c", event.Digit)
+	if handler := p.onDTMF.Load(); handler != nil {
+		(*handler)(event.Digit)
+	}
+}
+
+// SetDTMFHandler sets the function called once per telephone event received from the remote peer
+func (p *AudioPipeline) SetDTMFHandler(handler func(digit rune)) {
+	p.onDTMF.Store(&handler)
+}
+
 func (p *AudioPipeline) Decode(data []byte) ([]int16, error) {
 	if p.decoder == nil {
 		return nil, ErrDecoderNil
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"p2p-call/internal/audio/capture"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	speakingLevel    = 50 // RFC 6464 level (-dBov) louder than this counts as talking
+	speakingHangover = 400 * time.Millisecond
+)
+
+// speakingTracker follows the remote audio level header extension and tells whether
+// the remote side is talking without decoding audio
+type speakingTracker struct {
+	mu         sync.Mutex
+	level      uint8
+	lastVoice  time.Time
+	lastPacket time.Time
+}
+
+func (s *speakingTracker) update(level uint8, voice bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.level = level
+	s.lastPacket = now
+	if voice || level <= speakingLevel {
+		s.lastVoice = now
+	}
+}
+
+// state returns the last reported level and whether voice was seen within the hangover.
+// Packets stop during silence with DTX, so the level decays to silence without them.
+func (s *speakingTracker) state(now time.Time) (level uint8, speaking bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	level = s.level
+	if s.lastPacket.IsZero() || now.Sub(s.lastPacket) > speakingHangover {
+		level = 127
+	}
+	return level, !s.lastVoice.IsZero() && now.Sub(s.lastVoice) <= speakingHangover
+}
+
+// levelExtension is the RFC 6464 extension sent with a frame, the V bit tells voice from noise
+// so the receiver doesn't have to guess from the level
+func levelExtension(frame capture.Frame) *rtp.AudioLevelExtension {
+	return &rtp.AudioLevelExtension{Level: frame.Level, Voice: !frame.Silent}
+}
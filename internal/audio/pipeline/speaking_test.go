@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"p2p-call/internal/audio/capture"
+	"testing"
+	"time"
+)
+
+func TestLevelExtensionVoiceBit(t *testing.T) {
+	for _, tc := range []struct {
+		frame capture.Frame
+		voice bool
+	}{
+		{capture.Frame{Level: 30}, true},
+		{capture.Frame{Level: 30, Silent: true}, false}, // loud noise without voice
+		{capture.Frame{Level: 127, Silent: true}, false},
+	} {
+		ext := levelExtension(tc.frame)
+		if ext.Level != tc.frame.Level || ext.Voice != tc.voice {
+			t.Errorf("frame %+v: extension %+v, want level %d voice %v", tc.frame, *ext, tc.frame.Level, tc.voice)
+		}
+		payload, err := ext.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := payload[0]&0x80 != 0; got != tc.voice {
+			t.Errorf("frame %+v: V bit %v on the wire, want %v", tc.frame, got, tc.voice)
+		}
+	}
+}
+
+func TestSpeakingTracker(t *testing.T) {
+	start := time.Unix(1000, 0)
+	type packet struct {
+		at    time.Duration
+		level uint8
+		voice bool
+	}
+	for _, tc := range []struct {
+		name     string
+		packets  []packet
+		at       time.Duration
+		level    uint8
+		speaking bool
+	}{
+		{"nothing received", nil, 0, 127, false},
+		{"loud packet", []packet{{0, 40, false}}, 0, 40, true},
+		{"threshold counts", []packet{{0, speakingLevel, false}}, 0, speakingLevel, true},
+		{"quiet packet", []packet{{0, speakingLevel + 1, false}}, 0, speakingLevel + 1, false},
+		{"quiet voice by the V bit", []packet{{0, 70, true}}, 0, 70, true},
+		{"hangover holds over quiet packets", []packet{{0, 40, false}, {200 * time.Millisecond, 70, false}}, speakingHangover, 70, true},
+		{"hangover ends", []packet{{0, 40, false}, {200 * time.Millisecond, 70, false}}, speakingHangover + time.Millisecond, 70, false},
+		{"packets stop with DTX", []packet{{0, 40, false}}, speakingHangover + time.Millisecond, 127, false},
+		{"talking again", []packet{{0, 40, false}, {time.Second, 45, false}}, time.Second + speakingHangover, 45, true},
+	} {
+		var s speakingTracker
+		for _, p := range tc.packets {
+			s.update(p.level, p.voice, start.Add(p.at))
+		}
+		level, speaking := s.state(start.Add(tc.at))
+		if level != tc.level || speaking != tc.speaking {
+			t.Errorf("%s: level %d speaking %v, want %d %v", tc.name, level, speaking, tc.level, tc.speaking)
+		}
+	}
+}
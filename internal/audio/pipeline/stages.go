@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"log"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/dsp"
+)
+
+// EnableOutputGain applies dB of fixed gain to received audio, the limiter keeps peaks from clipping
+func (p *AudioPipeline) EnableOutputGain(dB float64) error {
+	rate, channels := p.Capture.SampleRate() // both directions run at the codec rate
+	g := dsp.NewGainControl(rate*channels, dsp.GainConfig{Manual: dB})
+	if err := p.Playback.Chain().Register(chain.Stage{Name: config.StageGain, Process: processPCM(g.Process)}); err != nil {
+		return err
+	}
+	log.Printf("Output gain %+.0f dB", dB)
+	return nil
+}
+
+// SetStageBypass passes audio around the named processing stage of either direction, or through it again
+func (p *AudioPipeline) SetStageBypass(name string, bypassed bool) error {
+	if p.Playback.Chain().Has(name) {
+		return p.Playback.Chain().SetBypass(name, bypassed)
+	}
+	return p.Capture.Chain().SetBypass(name, bypassed)
+}
+
+// Stages returns the processing stages of both directions in order
+func (p *AudioPipeline) Stages() (capture, playback []chain.StageStats) {
+	return p.Capture.Chain().Stats(), p.Playback.Chain().Stats()
+}
+
+// processPCM adapts a function changing samples in place to a chain stage
+func processPCM(process func(samples []int16)) func(b *chain.Block) bool {
+	return func(b *chain.Block) bool {
+		process(b.PCM)
+		return true
+	}
+}
@@ -0,0 +1,70 @@
+package playback
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+const (
+	noiseFloorRise  = 1.005 // per frame rise of the noise floor estimate, about 2 dB/s
+	maxNoiseRMS     = 184   // -45 dBov, never fill gaps with anything louder
+	defaultNoiseRMS = 18    // -65 dBov when nothing is known about the remote background
+	noiseSmoothing  = 0.5   // one pole low pass, white noise sounds harsher than room noise
+)
+
+// comfortNoise fills gaps in received audio (suppressed silence, late packets) with noise
+// at the remote background level so silence does not sound like a dead line
+type comfortNoise struct {
+	active   bool    // set once the remote side sent anything, before that gaps stay silent
+	floorRMS float64 // background level estimated from decoded audio
+	cnRMS    float64 // level announced by RFC 3389 comfort noise packets, 0 if none
+	state    float64 // low pass filter state
+}
+
+// observe updates the noise floor with a decoded frame using minimum tracking
+func (c *comfortNoise) observe(decoded []int16) {
+	c.active = true
+	var sum float64
+	for _, s := range decoded {
+		sum += float64(s) * float64(s)
+	}
+	if len(decoded) == 0 || sum == 0 {
+		return
+	}
+	r := math.Sqrt(sum / float64(len(decoded)))
+	if c.floorRMS == 0 || r < c.floorRMS {
+		c.floorRMS = r
+	} else {
+		c.floorRMS *= noiseFloorRise
+	}
+}
+
+// setLevel applies a comfort noise packet level in -dBov
+func (c *comfortNoise) setLevel(level uint8) {
+	c.active = true
+	c.cnRMS = 32768 * math.Pow(10, -float64(level)/20)
+}
+
+// fill writes noise into out, or zeros before the remote side was heard
+func (c *comfortNoise) fill(out []int16) {
+	if !c.active {
+		clear(out)
+		return
+	}
+
+	level := c.floorRMS
+	if c.cnRMS > 0 {
+		level = c.cnRMS
+	}
+	if level == 0 {
+		level = defaultNoiseRMS
+	}
+	level = min(level, maxNoiseRMS)
+
+	// gain restores the RMS the low pass takes away from white noise
+	gain := level / math.Sqrt((1-noiseSmoothing)/(1+noiseSmoothing))
+	for i := range out {
+		c.state = noiseSmoothing*c.state + (1-noiseSmoothing)*rand.NormFloat64()
+		out[i] = int16(max(min(c.state*gain, math.MaxInt16), math.MinInt16))
+	}
+}
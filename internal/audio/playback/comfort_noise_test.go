@@ -0,0 +1,44 @@
+package playback
+
+import (
+	"math"
+	"testing"
+)
+
+func rms(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestComfortNoiseFollowsAnnouncedLevel(t *testing.T) {
+	out := make([]int16, 48000)
+	for _, tc := range []struct {
+		level uint8   // -dBov announced
+		want  float64 // RMS
+	}{
+		{50, 103.6},
+		{60, 32.8},
+		{70, 10.4},
+		{30, maxNoiseRMS}, // never louder than -45 dBov
+	} {
+		var c comfortNoise
+		c.observe([]int16{1000, -1000}) // a louder background estimate must not matter
+		c.setLevel(tc.level)
+		c.fill(out)
+		if got := rms(out); math.Abs(got-tc.want) > tc.want*0.1 {
+			t.Errorf("level %d: noise RMS %.1f, want %.1f", tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestComfortNoiseSilentUntilHeard(t *testing.T) {
+	out := []int16{1, 2, 3}
+	var c comfortNoise
+	c.fill(out)
+	if rms(out) != 0 {
+		t.Errorf("noise %v before the remote side was heard", out)
+	}
+}
@@ -0,0 +1,86 @@
+package playback
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/wav"
+	"path/filepath"
+	"strings"
+)
+
+// sampleWriter stores interleaved samples in a file
+type sampleWriter interface {
+	Write(samples []int16) error
+	Close() error // flushes, the file is closed by FilePlayback
+}
+
+// FilePlayback records received audio in real time at the codec rate and channel count,
+// as WAV when the file name ends in .wav, raw 16 bit little endian PCM otherwise
+type FilePlayback struct {
+	*stream
+	file *os.File
+	dest sampleWriter
+	done chan struct{}
+}
+
+func NewFilePlayback(audiocfg config.AudioConfig, path string) (*FilePlayback, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create playback file: %w", err)
+	}
+
+	var dest sampleWriter = &rawWriter{w: bufio.NewWriter(file)}
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		dest, err = wav.NewWriter(file, int(audiocfg.SampleRate), int(audiocfg.Channels))
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	fp := &FilePlayback{
+		stream: newStream(audiocfg),
+		file:   file,
+		dest:   dest,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(fp.done)
+		fp.pace(paceInterval, fp.write)
+	}()
+	log.Printf("Playing to %s", path)
+	return fp, nil
+}
+
+func (fp *FilePlayback) write(samples []int16) {
+	if err := fp.dest.Write(samples); err != nil {
+		log.Printf("Failed to write playback file: %v", err)
+	}
+}
+
+// Close stops playback and finishes the file
+func (fp *FilePlayback) Close() {
+	fp.close()
+	<-fp.done
+	if err := fp.dest.Close(); err != nil {
+		log.Printf("Failed to write playback file: %v", err)
+	}
+	_ = fp.file.Close()
+}
+
+// rawWriter writes headerless 16 bit little endian PCM
+type rawWriter struct {
+	w *bufio.Writer
+}
+
+func (r *rawWriter) Write(samples []int16) error {
+	return binary.Write(r.w, binary.LittleEndian, samples)
+}
+
+func (r *rawWriter) Close() error {
+	return r.w.Flush()
+}
@@ -0,0 +1,303 @@
+package playback
+
+import (
+	"fmt"
+	"log"
+	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/device"
+	"sync"
+	"time"
+
+	"github.com/gen2brain/malgo"
+)
+
+// watchInterval is how often the device list is checked for unplugged, returning and new default devices
+const watchInterval = 2 * time.Second
+
+// MalgoPlayback plays through a sound card, the default one unless a device was selected
+type MalgoPlayback struct {
+	*stream
+	ctx      *malgo.AllocatedContext
+	mu       sync.Mutex // guards the fields below while switching
+	device   *malgo.Device
+	active   device.Info // device is opened on, zero while none is open
+	playCfg  malgo.DeviceConfig
+	selector string // device requested by id or name, empty for the default
+	fallback string // device tried before the default when the selected one goes away
+	lost     string // device that went away while no other one could be opened
+	onChange func(device.Change)
+	gap      chan struct{} // closed to stop draining the buffer while no device is open
+	gapDone  chan struct{}
+	closed   bool
+}
+
+func (mp *MalgoPlayback) Close() {
+	mp.close()
+	mp.mu.Lock()
+	mp.closed = true
+	mp.endGap()
+	if mp.device != nil {
+		mp.device.Uninit()
+	}
+	mp.mu.Unlock()
+	if mp.ctx != nil {
+		_ = mp.ctx.Uninit()
+		mp.ctx.Free()
+	}
+}
+
+// NewMalgoPlayback prepares playback to the device selected by id or name part, empty selects the default.
+// When the device goes away playback moves to fallback, then to the default device.
+func NewMalgoPlayback(audiocfg config.AudioConfig, selector, fallback string) (*MalgoPlayback, error) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(msg string) {
+		log.Println("Malgo context message:", msg)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to init malgo context: %w", err)
+	}
+	mp := &MalgoPlayback{
+		stream:   newStream(audiocfg),
+		ctx:      ctx,
+		selector: selector,
+		fallback: fallback,
+	}
+
+	// the device runs at its native rate, the resample stage converts from the codec rate
+	playCfg := malgo.DefaultDeviceConfig(malgo.Playback)
+	playCfg.Playback.Format = malgo.FormatS16
+	playCfg.Playback.Channels = uint32(audiocfg.Channels)
+	playCfg.SampleRate = 0
+	mp.playCfg = playCfg
+
+	return mp, nil
+}
+
+// StartMalgoPlayback starts the playback device
+func (mp *MalgoPlayback) StartMalgoPlayback() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if err := mp.replace(mp.selector); err != nil {
+		return err
+	}
+	go mp.watch()
+
+	log.Printf("Playback device %q started", mp.active.Name)
+	return nil
+}
+
+// SwitchDevice moves playback to another device, buffered audio carries over.
+// The current device keeps running if the new one can't be opened.
+func (mp *MalgoPlayback) SwitchDevice(selector string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if err := mp.replace(selector); err != nil {
+		return err
+	}
+	mp.selector = selector
+	mp.lost = ""
+	log.Printf("Playback device switched to %q", mp.active.Name)
+	return nil
+}
+
+// OnDeviceChange sets the handler called when the device goes away and playback moves to another one
+func (mp *MalgoPlayback) OnDeviceChange(handler func(device.Change)) {
+	mp.mu.Lock()
+	mp.onChange = handler
+	mp.mu.Unlock()
+}
+
+// replace opens the selected device and moves playback to it, the caller holds mu.
+// The current device keeps running if the new one can't be opened.
+func (mp *MalgoPlayback) replace(selector string) error {
+	next, info, rate, err := mp.openDevice(selector)
+	if err != nil {
+		return err
+	}
+	filling := mp.gap != nil
+	mp.endGap()
+	if err := next.Start(); err != nil {
+		next.Uninit()
+		if filling {
+			mp.fillGap()
+		}
+		return fmt.Errorf("failed to start playback device: %w", err)
+	}
+	// the old device played at its rate until now
+	mp.setOutputRate(rate)
+	if mp.device != nil {
+		mp.device.Uninit()
+	}
+	mp.device = next
+	mp.active = info
+	return nil
+}
+
+// openDevice initialises the selected device and returns the rate it runs at, the caller holds mu
+func (mp *MalgoPlayback) openDevice(selector string) (*malgo.Device, device.Info, int, error) {
+	info, err := device.Find(mp.ctx.Context, malgo.Playback, selector)
+	if err != nil {
+		return nil, device.Info{}, 0, err
+	}
+	playCfg := mp.playCfg
+	// the default is opened without an id so backends that follow default changes can do so
+	if selector != "" {
+		playCfg.Playback.DeviceID = info.Pointer()
+	}
+
+	// the callback only copies the samples out, the resample stage converted them to the device rate
+	var rate int // set before the device starts, the native rate is known then
+	var samples []int16
+	onPlay := func(pOutputSamples, _ []byte, frameCount uint32) {
+		mp.period.Store(int64(time.Duration(frameCount) * time.Second / time.Duration(rate)))
+
+		samplesNeeded := int(frameCount * playCfg.Playback.Channels)
+		if cap(samples) < samplesNeeded {
+			samples = make([]int16, samplesNeeded)
+		}
+		samples = samples[:samplesNeeded]
+		mp.render(samples)
+		for i, sample := range samples {
+			pOutputSamples[i*2] = byte(sample)
+			pOutputSamples[i*2+1] = byte(sample >> 8)
+		}
+	}
+
+	var dev *malgo.Device
+	// called on the audio thread, which uninit waits for
+	onStop := func() {
+		go mp.deviceStopped(dev)
+	}
+
+	dev, err = malgo.InitDevice(mp.ctx.Context, playCfg, malgo.DeviceCallbacks{Data: onPlay, Stop: onStop})
+	if err != nil {
+		return nil, device.Info{}, 0, fmt.Errorf("failed to open playback device: %w", err)
+	}
+	rate = int(dev.SampleRate())
+	log.Printf("Playback device %q runs at %d Hz", info.Name, rate)
+	return dev, info, rate, nil
+}
+
+// deviceStopped moves playback elsewhere when the device stopped by itself, e.g. it was unplugged
+func (mp *MalgoPlayback) deviceStopped(dev *malgo.Device) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	// switching and closing stop devices on purpose
+	if mp.closed || mp.device != dev || dev.IsStarted() {
+		return
+	}
+	mp.lose()
+}
+
+// lose drops the device that went away and moves to the next candidate, the caller holds mu
+func (mp *MalgoPlayback) lose() {
+	lost := mp.active.Name
+	log.Printf("Playback device %q went away", lost)
+	mp.device.Uninit()
+	mp.device = nil
+	mp.active = device.Info{}
+	mp.fillGap()
+	mp.reopen(lost, true)
+}
+
+// reopen opens the first candidate device that works, the caller holds mu.
+// A failure is reported once, the watcher keeps retrying silently.
+func (mp *MalgoPlayback) reopen(lost string, report bool) {
+	var err error
+	for _, selector := range device.Candidates(mp.selector, mp.fallback) {
+		if err = mp.replace(selector); err == nil {
+			log.Printf("Playback moved to %q", mp.active.Name)
+			mp.lost = ""
+			mp.notify(device.Change{Kind: malgo.Playback, Lost: lost, Now: mp.active.Name})
+			return
+		}
+	}
+	mp.lost = lost
+	if report {
+		log.Printf("No playback device available: %v", err)
+		mp.notify(device.Change{Kind: malgo.Playback, Lost: lost, Err: err})
+	}
+}
+
+// watch retries while no device is open, notices devices removed without a stop,
+// returns to the selected device when it is plugged back and follows the default device
+func (mp *MalgoPlayback) watch() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mp.quit:
+			return
+		case <-ticker.C:
+		}
+
+		mp.mu.Lock()
+		if !mp.closed {
+			mp.check()
+		}
+		mp.mu.Unlock()
+	}
+}
+
+// check compares the open device with the device list, the caller holds mu
+func (mp *MalgoPlayback) check() {
+	if mp.device == nil {
+		mp.reopen(mp.lost, false)
+		return
+	}
+	if mp.active.ID == "" {
+		return // the backend can't list devices, nothing to compare with
+	}
+	devices, err := device.Scan(mp.ctx.Context, malgo.Playback)
+	if err != nil {
+		return
+	}
+	if !device.Present(devices, mp.active.ID) {
+		mp.lose()
+		return
+	}
+	want, err := device.Select(devices, mp.selector)
+	if err != nil || want.ID == mp.active.ID {
+		return
+	}
+
+	previous := mp.active.Name
+	if err := mp.replace(mp.selector); err != nil {
+		log.Printf("Failed to move playback to %q: %v", want.Name, err)
+		return
+	}
+	log.Printf("Playback moved to %q", mp.active.Name)
+	mp.notify(device.Change{Kind: malgo.Playback, Lost: previous, Now: mp.active.Name})
+}
+
+// fillGap keeps draining received audio while no device is open, so it doesn't pile up
+// and play late once a device is back. The caller holds mu.
+func (mp *MalgoPlayback) fillGap() {
+	if mp.gap != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	mp.gap, mp.gapDone = stop, done
+	go func() {
+		defer close(done)
+		mp.paceUntil(stop, paceInterval, func([]int16) {})
+	}()
+}
+
+// endGap stops draining and waits for it, the caller holds mu
+func (mp *MalgoPlayback) endGap() {
+	if mp.gap == nil {
+		return
+	}
+	close(mp.gap)
+	<-mp.gapDone
+	mp.gap, mp.gapDone = nil, nil
+}
+
+func (mp *MalgoPlayback) notify(change device.Change) {
+	if mp.onChange != nil {
+		go mp.onChange(change)
+	}
+}
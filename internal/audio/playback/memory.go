@@ -0,0 +1,35 @@
+package playback
+
+import (
+	"log"
+	"p2p-call/internal/audio/config"
+)
+
+// MemoryPlayback plays in real time into Out, blocks of interleaved samples are dropped
+// when nobody reads them. Out is closed with the playback.
+type MemoryPlayback struct {
+	*stream
+	Out chan []int16
+}
+
+func NewMemoryPlayback(audiocfg config.AudioConfig) *MemoryPlayback {
+	mp := &MemoryPlayback{
+		stream: newStream(audiocfg),
+		Out:    make(chan []int16, audiocfg.BufferSize),
+	}
+	go func() {
+		defer close(mp.Out)
+		mp.pace(paceInterval, func(samples []int16) {
+			select {
+			case mp.Out <- samples:
+			default:
+				log.Println("Memory playback full, dropping audio")
+			}
+		})
+	}()
+	return mp
+}
+
+func (mp *MemoryPlayback) Close() {
+	mp.close()
+}
@@ -0,0 +1,26 @@
+package playback
+
+import (
+	"log"
+	"p2p-call/internal/audio/config"
+	"time"
+)
+
+// paceInterval is how often paced backends take audio, like a sound card period
+const paceInterval = 10 * time.Millisecond
+
+// NullPlayback consumes received audio in real time and discards it, for machines without speakers
+type NullPlayback struct {
+	*stream
+}
+
+func NewNullPlayback(audiocfg config.AudioConfig) *NullPlayback {
+	np := &NullPlayback{stream: newStream(audiocfg)}
+	go np.pace(paceInterval, func([]int16) {})
+	log.Println("Null playback started")
+	return np
+}
+
+func (np *NullPlayback) Close() {
+	np.close()
+}
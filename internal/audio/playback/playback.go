@@ -1,140 +1,330 @@
 package playback
 
 import (
-	"fmt"
 	"log"
+	"p2p-call/internal/audio/chain"
 	"p2p-call/internal/audio/codec/iface"
 	"p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/convert"
+	"p2p-call/internal/metrics"
+	"slices"
 	"sync"
-
-	"github.com/gen2brain/malgo"
+	"sync/atomic"
+	"time"
 )
 
-type MalgoPlayback struct {
-	Paused     bool
-	InChan     chan []byte
-	device     *malgo.Device
-	ctx        *malgo.AllocatedContext
-	PauseMutex sync.RWMutex
+const chainQueue = 10 // frames waiting between processing stages
+
+// stream decodes received packets and hands them out as the backend asks for audio,
+// shared by all playback backends. Packets run through the processing chain, decoding is a stage of it.
+type stream struct {
+	InChan chan []byte
+	chain  *chain.Chain
+	paused atomic.Bool
 
 	pcmBuffer []int16
 	bufferMu  sync.Mutex
+	noise     comfortNoise // guarded by bufferMu
+	played    uint64       // samples played since the remote side was first heard, guarded by bufferMu
+	concealed uint64       // part of played that had to be filled with noise, guarded by bufferMu
+	gap       uint64       // samples filled since the buffer ran dry, concealed if audio goes on without a new talkspurt
+	underruns int          // times the buffer ran dry during gap
+	dtx       bool         // the remote suppresses silence, its gaps are not loss, guarded by bufferMu
 	dec       iface.Decoder
-	playCfg   malgo.DeviceConfig
+	codecRate int // samples per second and channel the decoder puts out
+	rate      int // samples per second in pcmBuffer, the device's once resampled, guarded by bufferMu
+	channels  int
+	outRate   atomic.Int64                  // samples per second and channel the device plays, 0 for the codec rate
+	resampler *convert.Resampler            // used by the resample stage only
+	period    atomic.Int64                  // how much audio the backend takes at once
+	monitor   atomic.Pointer[func([]int16)] // sees everything played, e.g. the echo canceller reference
+	unplayed  *convert.Resampler            // takes played audio back to the codec rate for monitor, guarded by bufferMu
+	quit      chan struct{}
 }
 
-func (mp *MalgoPlayback) Close() {
-	if mp.device != nil {
-		mp.device.Uninit()
+func newStream(audiocfg config.AudioConfig) *stream {
+	s := &stream{
+		InChan:    make(chan []byte, audiocfg.BufferSize),
+		pcmBuffer: make([]int16, 0, audiocfg.SampleRate), // one second buffer
+		dec:       audiocfg.Decoder,
+		codecRate: int(audiocfg.SampleRate),
+		rate:      int(audiocfg.SampleRate) * int(audiocfg.Channels),
+		channels:  int(audiocfg.Channels),
+		quit:      make(chan struct{}),
 	}
-	if mp.ctx != nil {
-		_ = mp.ctx.Uninit()
-		mp.ctx.Free()
+	s.paused.Store(true)
+
+	order := audiocfg.PlaybackChain
+	if len(order) == 0 {
+		order = config.PlaybackStages
+	}
+	// devices run at their own rate, decoded audio is converted right away
+	if !slices.Equal(order[:min(2, len(order))], []string{config.StageDecode, config.StageResample}) {
+		rest := slices.DeleteFunc(slices.Clone(order), func(name string) bool {
+			return name == config.StageDecode || name == config.StageResample
+		})
+		if slices.Contains(order, config.StageResample) {
+			log.Printf("Playback stages %v must follow %q and %q, moved behind them", rest, config.StageDecode, config.StageResample)
+		}
+		order = append([]string{config.StageDecode, config.StageResample}, rest...)
 	}
+	s.chain = chain.New("playback", order, config.PlaybackStages, []string{config.StageDecode, config.StageResample})
+	s.chain.Register(chain.Stage{Name: config.StageDecode, Process: s.decode})
+	s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample})
+	go s.receive()
+	return s
 }
 
-func NewMalgoPlayback(audiocfg config.AudioConfig) (*MalgoPlayback, error) {
-	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(msg string) {
-		log.Println("Malgo context message:", msg)
-	})
+// Chain returns the processing chain received audio runs through
+func (s *stream) Chain() *chain.Chain {
+	return s.chain
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to init malgo context: %w", err)
+// Packets returns the channel received encoded packets are queued on
+func (s *stream) Packets() chan<- []byte {
+	return s.InChan
+}
+
+// SetPaused silences the output
+func (s *stream) SetPaused(paused bool) {
+	s.paused.Store(paused)
+}
+
+// Paused reports whether the output is silenced
+func (s *stream) Paused() bool {
+	return s.paused.Load()
+}
+
+// render fills interleaved samples with decoded audio, gaps get comfort noise
+func (s *stream) render(out []int16) {
+	if s.paused.Load() {
+		clear(out)
+	} else {
+		s.renderBuffer(out)
 	}
-	mp := &MalgoPlayback{
-		InChan:    make(chan []byte, audiocfg.BufferSize),
-		Paused:    true,
-		ctx:       ctx,
-		pcmBuffer: make([]int16, 0, audiocfg.SampleRate), // one second buffer
-		dec:       audiocfg.Decoder,
+	if monitor := s.monitor.Load(); monitor != nil {
+		(*monitor)(s.atCodecRate(out))
 	}
+}
 
-	playCfg := malgo.DefaultDeviceConfig(malgo.Playback)
-	playCfg.Playback.Format = malgo.FormatS16
-	playCfg.Playback.Channels = uint32(audiocfg.Channels)
-	playCfg.SampleRate = audiocfg.SampleRate
-	mp.playCfg = playCfg
-	mp.dec = audiocfg.Decoder
+// atCodecRate converts audio about to be played back to the codec rate
+func (s *stream) atCodecRate(samples []int16) []int16 {
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+	from := s.rate / s.channels
+	if from == s.codecRate {
+		s.unplayed = nil
+		return samples
+	}
+	if s.unplayed != nil {
+		if current, _ := s.unplayed.Rates(); current != from {
+			s.unplayed = nil
+		}
+	}
+	if s.unplayed == nil {
+		s.unplayed = convert.NewResampler(from, s.codecRate, s.channels)
+	}
+	return s.unplayed.Process(samples)
+}
 
-	return mp, nil
+// SetMonitor sets a function that is passed all audio about to be played at the codec rate, nil removes it
+func (s *stream) SetMonitor(monitor func(samples []int16)) {
+	if monitor == nil {
+		s.monitor.Store(nil)
+		return
+	}
+	s.monitor.Store(&monitor)
 }
 
-// StartMalgoPlayback starts the playback device
-func (mp *MalgoPlayback) StartMalgoPlayback() error {
-	// decode packets in a separate goroutine
-	go mp.decodeWorker()
+// renderBuffer takes decoded audio from the buffer and conceals what is missing
+func (s *stream) renderBuffer(out []int16) {
 
-	onPlay := func(pOutputSamples, _ []byte, frameCount uint32) {
-		mp.PauseMutex.RLock()
-		paused := mp.Paused
-		mp.PauseMutex.RUnlock()
+	samplesNeeded := len(out)
 
-		if paused {
-			for i := range pOutputSamples {
-				pOutputSamples[i] = 0
-			}
-			return
+	s.bufferMu.Lock()
+	availableSamples := len(s.pcmBuffer)
+
+	if availableSamples >= samplesNeeded {
+		copy(out, s.pcmBuffer[:samplesNeeded])
+		s.pcmBuffer = s.pcmBuffer[samplesNeeded:]
+	} else {
+		// nothing heard from the remote side yet is not an underrun, neither is its suppressed silence
+		if s.noise.active && !s.dtx {
+			s.gap += uint64(samplesNeeded - availableSamples)
+			s.underruns++
 		}
+		copy(out, s.pcmBuffer)
+		s.noise.fill(out[availableSamples:])
+		s.pcmBuffer = s.pcmBuffer[:0]
+	}
+	if s.noise.active {
+		s.played += uint64(samplesNeeded)
+	}
+	buffered := s.bufferedLocked()
+	s.bufferMu.Unlock()
+	metrics.SetPlaybackBuffer(buffered)
+}
 
-		samplesNeeded := int(frameCount) * int(mp.playCfg.Playback.Channels)
+// pace renders the audio due every period and passes it to write,
+// following the wall clock so missed ticks don't let the buffer grow
+func (s *stream) pace(period time.Duration, write func(samples []int16)) {
+	s.paceUntil(nil, period, write)
+}
 
-		mp.bufferMu.Lock()
-		availableSamples := len(mp.pcmBuffer)
+// paceUntil paces like pace until stop is closed
+func (s *stream) paceUntil(stop <-chan struct{}, period time.Duration, write func(samples []int16)) {
+	s.period.Store(int64(period))
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
 
-		if availableSamples >= samplesNeeded {
-			for i := 0; i < samplesNeeded; i++ {
-				sample := mp.pcmBuffer[i]
-				pOutputSamples[i*2] = byte(sample)
-				pOutputSamples[i*2+1] = byte(sample >> 8)
-			}
-			mp.pcmBuffer = mp.pcmBuffer[samplesNeeded:]
-		} else if availableSamples > 0 {
-			for i := 0; i < availableSamples; i++ {
-				sample := mp.pcmBuffer[i]
-				pOutputSamples[i*2] = byte(sample)
-				pOutputSamples[i*2+1] = byte(sample >> 8)
-			}
-			for i := availableSamples * 2; i < len(pOutputSamples); i++ {
-				pOutputSamples[i] = 0
-			}
-			mp.pcmBuffer = mp.pcmBuffer[:0]
-		} else {
-			for i := range pOutputSamples {
-				pOutputSamples[i] = 0
+	s.bufferMu.Lock()
+	frameRate := s.rate / s.channels
+	s.bufferMu.Unlock()
+	start := time.Now()
+	rendered := 0 // per channel samples since start
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			due := int(now.Sub(start)*time.Duration(frameRate)/time.Second) - rendered
+			if due <= 0 {
+				continue
 			}
+			samples := make([]int16, due*s.channels)
+			s.render(samples)
+			write(samples)
+			rendered += due
 		}
-		mp.bufferMu.Unlock()
 	}
+}
 
-	playDev, err := malgo.InitDevice(mp.ctx.Context, mp.playCfg, malgo.DeviceCallbacks{Data: onPlay})
-	if err != nil {
-		return fmt.Errorf("failed to open playback device: %w", err)
+// receive runs incoming encoded packets through the chain and buffers the audio
+func (s *stream) receive() {
+	packets := chain.AddOnPipe(s.quit, func(packet []byte) (*chain.Block, bool) {
+		return &chain.Block{Data: packet}, packet != nil
+	}, s.InChan, chainQueue, func(*chain.Block) { metrics.PipelineDrop("receive") })
+
+	for b := range s.chain.Start(s.quit, packets, chainQueue) {
+		s.buffer(b)
 	}
-	mp.device = playDev
+}
 
-	if err := mp.device.Start(); err != nil {
-		return fmt.Errorf("failed to start playback device: %w", err)
+// buffer queues a processed block for playback
+func (s *stream) buffer(b *chain.Block) {
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+	if rate := b.Rate * s.channels; rate != s.rate {
+		s.rate, s.pcmBuffer = rate, s.pcmBuffer[:0] // audio for the previous device
 	}
+	s.pcmBuffer = append(s.pcmBuffer, b.PCM...)
+	s.noise.observe(b.PCM)
+	s.settleGapLocked(false)
+	s.dtx = false
+}
 
-	log.Println("Playback device started")
-	return nil
+// decode is the decoding stage
+func (s *stream) decode(b *chain.Block) bool {
+	decoded, err := s.dec.Decode(b.Data)
+	if err != nil {
+		log.Printf("decode err: %v", err)
+		return false
+	}
+	b.PCM = decoded
+	b.Rate = s.codecRate
+	if s.codecRate > 0 {
+		b.Duration = time.Duration(len(decoded)/s.channels) * time.Second / time.Duration(s.codecRate)
+	}
+	return true
 }
 
-// decodeWorker decode incoming encoded packets
-func (mp *MalgoPlayback) decodeWorker() {
-	for encodedPacket := range mp.InChan {
-		if encodedPacket == nil {
-			continue
+// resample is the resampling stage, it converts decoded audio to the rate the device plays
+func (s *stream) resample(b *chain.Block) bool {
+	to := int(s.outRate.Load())
+	if to == 0 || b.Rate == 0 || to == b.Rate {
+		if s.resampler != nil {
+			s.resampler = nil
+			s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample})
 		}
+		return true
+	}
+	current := 0
+	if s.resampler != nil {
+		_, current = s.resampler.Rates()
+	}
+	if current != to {
+		s.resampler = convert.NewResampler(b.Rate, to, s.channels)
+		s.chain.Register(chain.Stage{Name: config.StageResample, Process: s.resample, Delay: s.resampler.Delay()})
+		log.Printf("Resampling received audio from %d Hz to %d Hz", b.Rate, to)
+	}
+	b.PCM = s.resampler.Process(b.PCM)
+	b.Rate = to
+	return true
+}
 
-		decoded, err := mp.dec.Decode(encodedPacket)
-		if err != nil {
-			log.Printf("decode err: %v", err)
-			continue
-		}
+// setOutputRate sets the rate the device plays at, received audio is resampled to it
+func (s *stream) setOutputRate(rate int) {
+	s.outRate.Store(int64(rate))
+}
+
+// Concealment returns how many samples were played and how many of them were filled in for missing audio
+func (s *stream) Concealment() (concealed, played uint64) {
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+	return s.concealed, s.played
+}
+
+// Buffered returns how much decoded audio waits to be played
+func (s *stream) Buffered() time.Duration {
+	s.bufferMu.Lock()
+	defer s.bufferMu.Unlock()
+	return s.bufferedLocked()
+}
+
+// bufferedLocked returns how much decoded audio waits in pcmBuffer
+func (s *stream) bufferedLocked() time.Duration {
+	if s.rate == 0 {
+		return 0
+	}
+	return time.Duration(len(s.pcmBuffer)) * time.Second / time.Duration(s.rate)
+}
 
-		mp.bufferMu.Lock()
-		mp.pcmBuffer = append(mp.pcmBuffer, decoded...)
-		mp.bufferMu.Unlock()
+// DevicePeriod returns how much audio the backend takes at once plus the delay of the processing stages
+func (s *stream) DevicePeriod() time.Duration {
+	return time.Duration(s.period.Load()) + s.chain.Delay()
+}
+
+// SetComfortNoiseLevel sets the background level (-dBov) announced by the remote side,
+// used to fill gaps while the remote suppresses silence
+func (s *stream) SetComfortNoiseLevel(level uint8) {
+	s.bufferMu.Lock()
+	s.noise.setLevel(level)
+	s.settleGapLocked(true)
+	s.dtx = true
+	s.bufferMu.Unlock()
+}
+
+// StartTalkspurt marks a packet that starts speech after the remote suppressed silence (RTP marker).
+// The gap before it was silence, not loss, and so is the wait until its audio is decoded.
+func (s *stream) StartTalkspurt() {
+	s.bufferMu.Lock()
+	s.settleGapLocked(true)
+	s.dtx = true
+	s.bufferMu.Unlock()
+}
+
+// settleGapLocked decides about the gap once the remote is heard again: audio going on
+// without a new talkspurt means packets were late or lost, silence means nothing was missing
+func (s *stream) settleGapLocked(silence bool) {
+	if !silence && s.gap > 0 {
+		s.concealed += s.gap
+		metrics.PlaybackUnderruns(s.underruns)
 	}
+	s.gap, s.underruns = 0, 0
+}
+
+func (s *stream) close() {
+	close(s.quit)
 }
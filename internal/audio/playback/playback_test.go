@@ -0,0 +1,46 @@
+package playback
+
+import (
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/config"
+	"testing"
+)
+
+func TestDTXSilenceIsNotConcealed(t *testing.T) {
+	tests := []struct {
+		name      string
+		resume    func(s *stream)
+		concealed uint64
+	}{
+		{"comfort noise", func(s *stream) { s.SetComfortNoiseLevel(60) }, 0},
+		{"talkspurt", func(s *stream) { s.StartTalkspurt() }, 0},
+		{"late packets", func(*stream) {}, 2 * 160},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewPCMUConfig()
+			s := newStream(cfg)
+			defer s.close()
+
+			speech := make([]int16, cfg.FrameSamples)
+			for i := range speech {
+				speech[i] = 8000
+			}
+			out := make([]int16, cfg.FrameSamples)
+
+			// the sender goes silent once its speech was played, the buffer runs dry twice meanwhile
+			s.buffer(&chain.Block{PCM: speech, Rate: int(cfg.SampleRate)})
+			for range 3 {
+				s.renderBuffer(out)
+			}
+			tt.resume(s)
+			s.buffer(&chain.Block{PCM: speech, Rate: int(cfg.SampleRate)})
+			s.renderBuffer(out)
+
+			concealed, played := s.Concealment()
+			if concealed != tt.concealed || played != 4*uint64(cfg.FrameSamples) {
+				t.Errorf("concealed %d of %d samples, want %d of %d", concealed, played, tt.concealed, 4*cfg.FrameSamples)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xfffe
+)
+
+var (
+	ErrNotWAV            = errors.New("not a RIFF WAVE file")
+	ErrUnsupportedFormat = errors.New("unsupported WAV sample format")
+)
+
+// Format describes the samples of a WAV file
+type Format struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	float         bool
+}
+
+// Reader reads interleaved samples of a PCM or float WAV file as 16 bit
+type Reader struct {
+	r         io.ReadSeeker
+	format    Format
+	dataStart int64
+	dataSize  int64
+	remaining int64
+	buf       []byte
+}
+
+// NewReader parses the header and positions at the first sample.
+// 8, 16, 24 and 32 bit integer and 32 bit float samples are supported.
+func NewReader(r io.ReadSeeker) (*Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, ErrNotWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	reader := &Reader{r: r}
+	haveFormat := false
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("no data chunk: %w", ErrNotWAV)
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			if err := reader.readFormat(size); err != nil {
+				return nil, err
+			}
+			haveFormat = true
+			continue
+		case "data":
+			if !haveFormat {
+				return nil, fmt.Errorf("data before fmt chunk: %w", ErrNotWAV)
+			}
+			start, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			reader.dataStart = start
+			reader.dataSize = size
+			reader.remaining = size
+			return reader, nil
+		}
+		// chunks are padded to an even size
+		if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Reader) readFormat(size int64) error {
+	if size < 16 {
+		return fmt.Errorf("short fmt chunk: %w", ErrNotWAV)
+	}
+	chunk := make([]byte, size+size%2)
+	if _, err := io.ReadFull(r.r, chunk); err != nil {
+		return fmt.Errorf("short fmt chunk: %w", ErrNotWAV)
+	}
+
+	tag := binary.LittleEndian.Uint16(chunk[0:2])
+	if tag == formatExtensible && size >= 26 {
+		tag = binary.LittleEndian.Uint16(chunk[24:26]) // first two bytes of the sub format GUID
+	}
+	r.format = Format{
+		Channels:      int(binary.LittleEndian.Uint16(chunk[2:4])),
+		SampleRate:    int(binary.LittleEndian.Uint32(chunk[4:8])),
+		BitsPerSample: int(binary.LittleEndian.Uint16(chunk[14:16])),
+		float:         tag == formatFloat,
+	}
+
+	switch {
+	case r.format.Channels == 0 || r.format.SampleRate == 0:
+		return fmt.Errorf("%w: %d channels at %d Hz", ErrUnsupportedFormat, r.format.Channels, r.format.SampleRate)
+	case tag == formatPCM && (r.format.BitsPerSample == 8 || r.format.BitsPerSample == 16 ||
+		r.format.BitsPerSample == 24 || r.format.BitsPerSample == 32):
+	case tag == formatFloat && r.format.BitsPerSample == 32:
+	default:
+		return fmt.Errorf("%w: format %d with %d bits", ErrUnsupportedFormat, tag, r.format.BitsPerSample)
+	}
+	return nil
+}
+
+// Format returns the format samples are stored in
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Duration returns the length of the audio
+func (r *Reader) Duration() time.Duration {
+	frameBytes := int64(r.format.Channels * r.format.BitsPerSample / 8)
+	return time.Duration(r.dataSize/frameBytes) * time.Second / time.Duration(r.format.SampleRate)
+}
+
+// Read fills samples with interleaved 16 bit samples and returns how many were read,
+// io.EOF when the data ends
+func (r *Reader) Read(samples []int16) (int, error) {
+	width := r.format.BitsPerSample / 8
+	want := min(int64(len(samples)*width), r.remaining)
+	want -= want % int64(width)
+	if want == 0 {
+		return 0, io.EOF
+	}
+	if int64(cap(r.buf)) < want {
+		r.buf = make([]byte, want)
+	}
+	buf := r.buf[:want]
+
+	n, err := io.ReadFull(r.r, buf)
+	r.remaining -= int64(n)
+	count := n / width
+	for i := 0; i < count; i++ {
+		samples[i] = r.sample(buf[i*width:])
+	}
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			r.remaining = 0 // truncated file, data size in the header was too large
+			err = io.EOF
+		}
+		return count, err
+	}
+	if r.remaining < int64(width) {
+		return count, io.EOF
+	}
+	return count, nil
+}
+
+// sample converts one stored sample to 16 bit
+func (r *Reader) sample(b []byte) int16 {
+	switch r.format.BitsPerSample {
+	case 8:
+		return int16(b[0]-128) << 8 // 8 bit WAV is unsigned
+	case 16:
+		return int16(binary.LittleEndian.Uint16(b))
+	case 24:
+		return int16(uint16(b[1]) | uint16(b[2])<<8)
+	default:
+		bits := binary.LittleEndian.Uint32(b)
+		if !r.format.float {
+			return int16(bits >> 16)
+		}
+		v := float64(math.Float32frombits(bits))
+		return int16(max(min(v*math.MaxInt16, math.MaxInt16), math.MinInt16))
+	}
+}
+
+// Rewind goes back to the first sample
+func (r *Reader) Rewind() error {
+	if _, err := r.r.Seek(r.dataStart, io.SeekStart); err != nil {
+		return err
+	}
+	r.remaining = r.dataSize
+	return nil
+}
@@ -0,0 +1,130 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	written := []int16{0, 1000, -1000, math.MaxInt16, math.MinInt16, 42}
+	w, err := NewWriter(file, 8000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(written[:4]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(written[4:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := r.Format(); f.SampleRate != 8000 || f.Channels != 2 || f.BitsPerSample != 16 {
+		t.Fatalf("format = %+v", f)
+	}
+	if d := r.Duration(); d != 375*time.Microsecond {
+		t.Errorf("duration = %v, want 375µs", d)
+	}
+
+	read := make([]int16, 10)
+	n, err := r.Read(read)
+	if n != len(written) || !errors.Is(err, io.EOF) {
+		t.Fatalf("Read = %d, %v, want %d samples and EOF", n, err, len(written))
+	}
+	if !slices.Equal(read[:n], written) {
+		t.Fatalf("read %v, want %v", read[:n], written)
+	}
+
+	if err := r.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	n, _ = r.Read(read[:2])
+	if n != 2 || read[0] != 0 || read[1] != 1000 {
+		t.Errorf("after rewind read %v", read[:n])
+	}
+}
+
+// wavBytes builds a file with an extra chunk before the data
+func wavBytes(tag uint16, bits int, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.WriteString("WAVE")
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	b.Write([]byte{1, 2, 3, 0}) // odd size, padded
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16))
+	binary.Write(&b, binary.LittleEndian, tag)
+	binary.Write(&b, binary.LittleEndian, uint16(1))
+	binary.Write(&b, binary.LittleEndian, uint32(16000))
+	binary.Write(&b, binary.LittleEndian, uint32(16000*bits/8))
+	binary.Write(&b, binary.LittleEndian, uint16(bits/8))
+	binary.Write(&b, binary.LittleEndian, uint16(bits))
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReadConvertsSampleFormats(t *testing.T) {
+	float := func(v float32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(v))
+	}
+	tests := []struct {
+		name string
+		tag  uint16
+		bits int
+		data []byte
+		want []int16
+	}{
+		{"8 bit", formatPCM, 8, []byte{0, 128, 255}, []int16{-32768, 0, 32512}},
+		{"24 bit", formatPCM, 24, []byte{0xff, 0x00, 0x40, 0x00, 0x00, 0x80}, []int16{0x4000, -32768}},
+		{"float", formatFloat, 32, append(float(0.5), float(-2)...), []int16{16383, -32768}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(wavBytes(tt.tag, tt.bits, tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int16, 8)
+			n, _ := r.Read(got)
+			if !slices.Equal(got[:n], tt.want) {
+				t.Errorf("got %v, want %v", got[:n], tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectsOtherFiles(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("ID3 not a wave file"))); !errors.Is(err, ErrNotWAV) {
+		t.Errorf("mp3: got %v, want ErrNotWAV", err)
+	}
+	if _, err := NewReader(bytes.NewReader(wavBytes(2, 4, nil))); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("ADPCM: got %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,81 @@
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const headerSize = 44
+
+// Writer writes interleaved 16 bit PCM samples to a WAV file
+type Writer struct {
+	w        io.WriteSeeker
+	buf      *bufio.Writer
+	format   Format
+	dataSize int64
+}
+
+// NewWriter writes the header, sizes are filled in by Close
+func NewWriter(w io.WriteSeeker, sampleRate, channels int) (*Writer, error) {
+	writer := &Writer{
+		w:      w,
+		buf:    bufio.NewWriter(w),
+		format: Format{SampleRate: sampleRate, Channels: channels, BitsPerSample: 16},
+	}
+	if err := writer.writeHeader(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) writeHeader() error {
+	blockAlign := w.format.Channels * w.format.BitsPerSample / 8
+	dataSize := uint32(min(w.dataSize, math.MaxUint32-headerSize))
+
+	var header [headerSize]byte
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], headerSize-8+dataSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], formatPCM)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(w.format.Channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(w.format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(w.format.SampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:36], uint16(w.format.BitsPerSample))
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+
+	_, err := w.buf.Write(header[:])
+	return err
+}
+
+// Write appends interleaved samples
+func (w *Writer) Write(samples []int16) error {
+	if err := binary.Write(w.buf, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	w.dataSize += int64(len(samples) * 2)
+	return nil
+}
+
+// Close flushes the samples and writes the final sizes into the header, the underlying file stays open
+func (w *Writer) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
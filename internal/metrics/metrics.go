@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "p2pcall"
+
+var (
+	candidatePair = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ice_candidate_pair",
+		Help:      "Selected ICE candidate pair, 1 for the pair in use.",
+	}, []string{"local", "remote"})
+
+	discoveryStrategy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "discovery_strategy",
+		Help:      "Discovery method that found the peer, 1 for the one used.",
+	}, []string{"strategy"})
+
+	timeToConnect = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "time_to_connect_seconds",
+		Help:      "Time from starting the call until the peer connection was established.",
+	})
+
+	pipelineDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pipeline_dropped_total",
+		Help:      "Audio frames dropped by a pipeline stage, because the next stage was full or the stage refused them.",
+	}, []string{"stage"})
+
+	stageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pipeline_stage_seconds",
+		Help:      "Time an audio processing stage takes per frame.",
+		Buckets:   prometheus.ExponentialBuckets(10e-6, 2, 12), // 10 us to 20 ms
+	}, []string{"stage"})
+
+	playbackBuffer = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "playback_buffer_seconds",
+		Help:      "Decoded audio waiting in the playback jitter buffer.",
+	})
+
+	mos = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quality_mos",
+		Help:      "Estimated mean opinion score of received audio (E-model).",
+	})
+
+	rFactor = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quality_r_factor",
+		Help:      "Estimated E-model transmission rating of received audio.",
+	})
+
+	latency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "latency_seconds",
+		Help:      "Estimated mouth-to-ear delay of received audio by component, total is the sum.",
+	}, []string{"component"})
+
+	playbackUnderruns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "playback_underruns_total",
+		Help:      "Playback callbacks that ran out of received audio.",
+	})
+)
+
+// Serve exposes /metrics on addr, blocks until the server fails
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// SetCandidatePair records the selected candidate pair, replacing the previous one
+func SetCandidatePair(local, remote string) {
+	candidatePair.Reset()
+	candidatePair.WithLabelValues(local, remote).Set(1)
+}
+
+// SetDiscoveryStrategy records which discovery method found the peer
+func SetDiscoveryStrategy(strategy string) {
+	discoveryStrategy.Reset()
+	discoveryStrategy.WithLabelValues(strategy).Set(1)
+}
+
+func SetTimeToConnect(d time.Duration) {
+	timeToConnect.Set(d.Seconds())
+}
+
+// PipelineDrop counts a frame dropped at stage
+func PipelineDrop(stage string) {
+	pipelineDrops.WithLabelValues(stage).Inc()
+}
+
+// ObserveStage records how long stage took to process one frame
+func ObserveStage(stage string, d time.Duration) {
+	stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+func SetPlaybackBuffer(d time.Duration) {
+	playbackBuffer.Set(d.Seconds())
+}
+
+func PlaybackUnderruns(count int) {
+	playbackUnderruns.Add(float64(count))
+}
+
+// SetQuality records the latest call quality estimate
+func SetQuality(r, meanOpinion float64) {
+	rFactor.Set(r)
+	mos.Set(meanOpinion)
+}
+
+// SetLatency records the mouth-to-ear delay components
+func SetLatency(capture, network, buffer, playback time.Duration) {
+	latency.WithLabelValues("capture").Set(capture.Seconds())
+	latency.WithLabelValues("network").Set(network.Seconds())
+	latency.WithLabelValues("buffer").Set(buffer.Seconds())
+	latency.WithLabelValues("playback").Set(playback.Seconds())
+	latency.WithLabelValues("total").Set((capture + network + buffer + playback).Seconds())
+}
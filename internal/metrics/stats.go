@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	inbound  = "inbound"
+	outbound = "outbound"
+)
+
+var (
+	packetsDesc = prometheus.NewDesc(namespace+"_rtp_packets_total",
+		"RTP packets received (inbound) or sent (outbound).", []string{"direction"}, nil)
+	bytesDesc = prometheus.NewDesc(namespace+"_rtp_bytes_total",
+		"RTP payload bytes received (inbound) or sent (outbound).", []string{"direction"}, nil)
+	lostDesc = prometheus.NewDesc(namespace+"_rtp_packets_lost_total",
+		"RTP packets lost, outbound as reported by the remote peer.", []string{"direction"}, nil)
+	jitterDesc = prometheus.NewDesc(namespace+"_rtp_jitter_seconds",
+		"Interarrival jitter, outbound as reported by the remote peer.", []string{"direction"}, nil)
+	rttDesc = prometheus.NewDesc(namespace+"_rtt_seconds",
+		"Round trip time from RTCP reports.", nil, nil)
+)
+
+// StatsGetter is implemented by webrtc.PeerConnection
+type StatsGetter interface {
+	GetStats() webrtc.StatsReport
+}
+
+// statsCollector reads RTP statistics of the current connection on every scrape
+type statsCollector struct {
+	mu sync.Mutex
+	pc StatsGetter // nil until the first connection
+}
+
+var connectionStats = &statsCollector{}
+
+func init() {
+	prometheus.MustRegister(connectionStats)
+}
+
+// RegisterConnection exports RTP statistics of pc in place of the connection registered before
+func RegisterConnection(pc StatsGetter) {
+	connectionStats.mu.Lock()
+	connectionStats.pc = pc
+	connectionStats.mu.Unlock()
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- packetsDesc
+	ch <- bytesDesc
+	ch <- lostDesc
+	ch <- jitterDesc
+	ch <- rttDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	pc := c.pc
+	c.mu.Unlock()
+	if pc == nil {
+		return
+	}
+	for _, stat := range pc.GetStats() {
+		switch s := stat.(type) {
+		case webrtc.InboundRTPStreamStats:
+			ch <- prometheus.MustNewConstMetric(packetsDesc, prometheus.CounterValue, float64(s.PacketsReceived), inbound)
+			ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(s.BytesReceived), inbound)
+			ch <- prometheus.MustNewConstMetric(lostDesc, prometheus.CounterValue, float64(max(s.PacketsLost, 0)), inbound)
+			ch <- prometheus.MustNewConstMetric(jitterDesc, prometheus.GaugeValue, s.Jitter, inbound)
+		case webrtc.OutboundRTPStreamStats:
+			ch <- prometheus.MustNewConstMetric(packetsDesc, prometheus.CounterValue, float64(s.PacketsSent), outbound)
+			ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(s.BytesSent), outbound)
+		case webrtc.RemoteInboundRTPStreamStats: // the peer's view of our outgoing stream
+			ch <- prometheus.MustNewConstMetric(lostDesc, prometheus.CounterValue, float64(max(s.PacketsLost, 0)), outbound)
+			ch <- prometheus.MustNewConstMetric(jitterDesc, prometheus.GaugeValue, s.Jitter, outbound)
+			ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, s.RoundTripTime)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package nettest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	checkTimeout = 5 * time.Second
+	dhtTimeout   = 10 * time.Second
+)
+
+// NAT mapping behaviour (RFC 4787) seen from the reflexive addresses of two STUN servers
+const (
+	MappingUnknown     = "unknown"
+	MappingNone        = "no NAT"
+	MappingIndependent = "endpoint independent"
+	MappingDependent   = "address dependent (symmetric NAT)"
+)
+
+// Verdicts printed at the end of the test
+const (
+	VerdictDirect  = "direct calls likely"
+	VerdictRelay   = "relay required"
+	VerdictNoRelay = "relay required, but no TURN server works"
+	VerdictBlocked = "blocked"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Report collects all checks of a test run
+type Report struct {
+	STUN    []Result
+	TURN    []Result
+	TCP     []Result
+	DHT     Result
+	UDP     bool // any STUN server answered over UDP
+	Mapping string
+	Verdict string
+}
+
+// Run checks STUN and TURN servers, UDP and TCP reachability and DHT bootstrap peers
+func Run(ctx context.Context, stunServers, turnServers []webrtc.ICEServer, bootstrap []multiaddr.Multiaddr) Report {
+	var report Report
+	report.STUN, report.Mapping = checkSTUN(stunServers)
+	for _, r := range report.STUN {
+		report.UDP = report.UDP || r.OK
+	}
+	report.TURN = checkTURN(turnServers)
+	report.TCP = checkTCP(turnServers)
+	report.DHT = checkDHT(ctx, bootstrap)
+	report.Verdict = verdict(report)
+	return report
+}
+
+// checkSTUN sends binding requests to every server from one socket, the reflexive addresses
+// tell whether the NAT keeps the same mapping for different destinations
+func checkSTUN(servers []webrtc.ICEServer) ([]Result, string) {
+	var results []Result
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	if err != nil {
+		return []Result{{Name: "udp socket", Detail: err.Error()}}, MappingUnknown
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{Conn: conn, RTO: time.Second})
+	if err != nil {
+		return []Result{{Name: "stun client", Detail: err.Error()}}, MappingUnknown
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return []Result{{Name: "stun client", Detail: err.Error()}}, MappingUnknown
+	}
+
+	var mapped []*net.UDPAddr
+	for _, rawURL := range urls(servers) {
+		uri, err := stun.ParseURI(rawURL)
+		if err != nil || uri.Scheme != stun.SchemeTypeSTUN {
+			continue
+		}
+		result := Result{Name: rawURL}
+		addr, err := net.ResolveUDPAddr("udp4", hostPort(uri))
+		if err != nil {
+			result.Detail = err.Error()
+			results = append(results, result)
+			continue
+		}
+		reflexive, err := withTimeout(func() (net.Addr, error) { return client.SendBindingRequestTo(addr) })
+		if err != nil {
+			result.Detail = err.Error()
+		} else {
+			result.OK = true
+			result.Detail = "reflexive address " + reflexive.String()
+			if udpAddr, ok := reflexive.(*net.UDPAddr); ok {
+				mapped = append(mapped, udpAddr)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, mappingBehaviour(mapped)
+}
+
+func mappingBehaviour(mapped []*net.UDPAddr) string {
+	if len(mapped) == 0 {
+		return MappingUnknown
+	}
+	if isLocalIP(mapped[0].IP) {
+		return MappingNone
+	}
+	if len(mapped) < 2 {
+		return MappingUnknown // needs two servers
+	}
+	for _, addr := range mapped[1:] {
+		if !addr.IP.Equal(mapped[0].IP) || addr.Port != mapped[0].Port {
+			return MappingDependent
+		}
+	}
+	return MappingIndependent
+}
+
+// checkTURN allocates a relay on every TURN server with its configured credentials
+func checkTURN(servers []webrtc.ICEServer) []Result {
+	var results []Result
+	for _, server := range servers {
+		credential, _ := server.Credential.(string)
+		for _, rawURL := range server.URLs {
+			uri, err := stun.ParseURI(rawURL)
+			if err != nil || (uri.Scheme != stun.SchemeTypeTURN && uri.Scheme != stun.SchemeTypeTURNS) {
+				continue
+			}
+			result := Result{Name: rawURL}
+			relay, err := allocate(uri, server.Username, credential)
+			if err != nil {
+				result.Detail = err.Error()
+			} else {
+				result.OK = true
+				result.Detail = "relay address " + relay.String()
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func allocate(uri *stun.URI, username, password string) (net.Addr, error) {
+	addr := hostPort(uri)
+	var conn net.PacketConn
+	switch {
+	case uri.Scheme == stun.SchemeTypeTURNS:
+		tlsConn, err := tls.DialWithDialer(&net.Dialer{Timeout: checkTimeout}, "tcp", addr, &tls.Config{ServerName: uri.Host})
+		if err != nil {
+			return nil, err
+		}
+		conn = turn.NewSTUNConn(tlsConn)
+	case uri.Proto == stun.ProtoTypeTCP:
+		tcpConn, err := net.DialTimeout("tcp", addr, checkTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn = turn.NewSTUNConn(tcpConn)
+	default:
+		udpConn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		if err != nil {
+			return nil, err
+		}
+		conn = udpConn
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Conn:           conn,
+		Username:       username,
+		Password:       password,
+		RTO:            time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return nil, err
+	}
+
+	return withTimeout(func() (net.Addr, error) {
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return nil, err
+		}
+		defer relayConn.Close()
+		return relayConn.LocalAddr(), nil
+	})
+}
+
+// checkTCP connects to the TURN servers reached over TCP or TLS: where UDP is blocked they are
+// the way out, and a connection that gets through tells a firewall from a failing server
+func checkTCP(servers []webrtc.ICEServer) []Result {
+	seen := make(map[string]bool)
+	var results []Result
+	for _, rawURL := range urls(servers) {
+		uri, err := stun.ParseURI(rawURL)
+		if err != nil || (uri.Scheme != stun.SchemeTypeTURNS && (uri.Scheme != stun.SchemeTypeTURN || uri.Proto != stun.ProtoTypeTCP)) {
+			continue
+		}
+		addr := hostPort(uri)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		result := Result{Name: "tcp " + addr}
+		conn, err := net.DialTimeout("tcp", addr, checkTimeout)
+		if err != nil {
+			result.Detail = err.Error()
+		} else {
+			conn.Close()
+			result.OK = true
+			result.Detail = "connected"
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkDHT connects to the bootstrap peers discovery over the internet starts from
+func checkDHT(ctx context.Context, bootstrap []multiaddr.Multiaddr) Result {
+	result := Result{Name: "dht bootstrap"}
+	host, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer host.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, dhtTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reached := 0
+	for _, addr := range bootstrap {
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if host.Connect(ctx, *info) == nil {
+				mu.Lock()
+				reached++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.OK = reached > 0
+	result.Detail = fmt.Sprintf("%d of %d bootstrap peers reachable", reached, len(bootstrap))
+	return result
+}
+
+// verdict sums the checks up for the user. Without UDP a TURN server reached over TCP
+// means the network lets calls out, a relay that works is all that is missing.
+func verdict(r Report) string {
+	turnOK, tcpOK := false, false
+	for _, result := range r.TURN {
+		turnOK = turnOK || result.OK
+	}
+	for _, result := range r.TCP {
+		tcpOK = tcpOK || result.OK
+	}
+	switch {
+	case r.UDP && r.Mapping != MappingDependent:
+		return VerdictDirect
+	case turnOK:
+		return VerdictRelay
+	case r.UDP || tcpOK:
+		return VerdictNoRelay
+	default:
+		return VerdictBlocked
+	}
+}
+
+// Print writes the report in a human readable form
+func (r Report) Print(w io.Writer) {
+	section := func(title string, results []Result) {
+		fmt.Fprintf(w, "%s:\n", title)
+		if len(results) == 0 {
+			fmt.Fprintln(w, "  none configured")
+		}
+		for _, result := range results {
+			status := "FAIL"
+			if result.OK {
+				status = "OK"
+			}
+			fmt.Fprintf(w, "  [%s] %s: %s\n", status, result.Name, result.Detail)
+		}
+	}
+	section("STUN", r.STUN)
+	fmt.Fprintf(w, "  NAT mapping: %s\n", r.Mapping)
+	section("TURN", r.TURN)
+	section("TCP", r.TCP)
+	section("DHT", []Result{r.DHT})
+	fmt.Fprintf(w, "Verdict: %s\n", r.Verdict)
+	if !r.DHT.OK {
+		fmt.Fprintln(w, "Note: DHT is unreachable, peers can only be found on the local network")
+	}
+}
+
+// withTimeout bounds transactions, the turn client retransmits for a long time on silent networks
+func withTimeout(f func() (net.Addr, error)) (net.Addr, error) {
+	type result struct {
+		addr net.Addr
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addr, err := f()
+		done <- result{addr, err}
+	}()
+	select {
+	case r := <-done:
+		return r.addr, r.err
+	case <-time.After(checkTimeout):
+		return nil, fmt.Errorf("no response within %v", checkTimeout)
+	}
+}
+
+func urls(servers []webrtc.ICEServer) []string {
+	var list []string
+	for _, server := range servers {
+		list = append(list, server.URLs...)
+	}
+	return list
+}
+
+func hostPort(uri *stun.URI) string {
+	return net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+}
+
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package nettest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestVerdict(t *testing.T) {
+	cases := []struct {
+		name   string
+		report Report
+		want   string
+	}{
+		{"cone nat", Report{UDP: true, Mapping: MappingIndependent}, VerdictDirect},
+		{"single stun server", Report{UDP: true, Mapping: MappingUnknown}, VerdictDirect},
+		{"symmetric with turn", Report{UDP: true, Mapping: MappingDependent, TURN: []Result{{OK: true}}}, VerdictRelay},
+		{"udp blocked with turn over tcp", Report{TURN: []Result{{OK: false}, {OK: true}}}, VerdictRelay},
+		{"symmetric without turn", Report{UDP: true, Mapping: MappingDependent, TURN: []Result{{OK: false}}}, VerdictNoRelay},
+		{"udp blocked, turn over tcp reached but refused", Report{TURN: []Result{{OK: false}}, TCP: []Result{{OK: true}}}, VerdictNoRelay},
+		{"udp and tcp blocked", Report{TURN: []Result{{OK: false}}, TCP: []Result{{OK: false}}}, VerdictBlocked},
+		{"nothing works", Report{Mapping: MappingUnknown}, VerdictBlocked},
+	}
+	for _, c := range cases {
+		if got := verdict(c.report); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMappingBehaviour(t *testing.T) {
+	a := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	b := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40001}
+
+	if got := mappingBehaviour([]*net.UDPAddr{a, a}); got != MappingIndependent {
+		t.Errorf("same mapping: got %q", got)
+	}
+	if got := mappingBehaviour([]*net.UDPAddr{a, b}); got != MappingDependent {
+		t.Errorf("different ports: got %q", got)
+	}
+	if got := mappingBehaviour([]*net.UDPAddr{a}); got != MappingUnknown {
+		t.Errorf("one server: got %q", got)
+	}
+}
+
+func TestCheckTCPProbesTURNOverTCPOnly(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	servers := []webrtc.ICEServer{
+		{URLs: []string{"stun:" + addr}},
+		{URLs: []string{"turn:" + addr, "turn:" + addr + "?transport=tcp"}, Username: "user", Credential: "pass"},
+	}
+	results := checkTCP(servers)
+	if len(results) != 1 || !results[0].OK || results[0].Name != "tcp "+addr {
+		t.Errorf("results %+v, want one successful probe of %s", results, addr)
+	}
+}
@@ -2,6 +2,7 @@ package discovery
 
 import (
 	"context"
+	"p2p-call/internal/metrics"
 	"p2p-call/internal/p2p/base"
 	"p2p-call/internal/p2p/dht"
 	"p2p-call/internal/p2p/mdns"
@@ -46,6 +47,7 @@ func (d *DiscoverManager) StartDiscovery(ctx context.Context, ready chan struct{
 		}
 
 		log.Info().Msg("mDNS discovery succeeded")
+		metrics.SetDiscoveryStrategy("mdns")
 		peerFound <- struct{}{}
 		dhtCancel() // stop dht if running
 
@@ -64,6 +66,7 @@ func (d *DiscoverManager) StartDiscovery(ctx context.Context, ready chan struct{
 			}
 
 			log.Info().Msg("DHT discovery succeeded")
+			metrics.SetDiscoveryStrategy("dht")
 			peerFound <- struct{}{}
 			mdnsCancel() // stop mdns if running
 			return
@@ -77,6 +80,7 @@ func (d *DiscoverManager) StartDiscovery(ctx context.Context, ready chan struct{
 		select {
 		case <-ready:
 			log.Info().Msg("Stream established, stopping discovery")
+			metrics.SetDiscoveryStrategy("remote") // the peer found us first
 			return nil
 		case <-peerFound:
 			log.Info().Msg("Peer discovery succeeded")
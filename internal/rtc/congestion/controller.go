@@ -0,0 +1,250 @@
+package congestion
+
+import (
+	"math"
+	"p2p-call/internal/audio/codec/iface"
+	"p2p-call/pkg/config"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	lossHigh    = 0.10 // loss above which bitrate is cut
+	lossLow     = 0.02 // loss below which bitrate may grow
+	lossFECOn   = 0.01 // loss that turns in-band FEC on
+	lossFECOff  = 0.005
+	jitterHigh  = 50 * time.Millisecond
+	jitterLow   = 30 * time.Millisecond
+	decrease    = 0.75 // multiplicative decrease on congestion
+	increase    = 1.08 // slow probing back up when the link is clean
+	attackAlpha = 0.5  // smoothing when conditions get worse, react fast
+	decayAlpha  = 0.1  // smoothing when conditions improve, recover slowly
+
+	baseFrameDuration = 20 * time.Millisecond
+)
+
+// FrameSizer changes the duration of captured frames
+type FrameSizer interface {
+	SetFrameDuration(d time.Duration) error
+}
+
+// RedundancySwitch turns redundant audio on and off
+type RedundancySwitch interface {
+	SetRedundancy(distance int)
+}
+
+// Controller adapts encoder settings to the loss and jitter the remote peer reports
+// in RTCP receiver report blocks about our outgoing stream
+type Controller struct {
+	cfg       config.BitrateConfig
+	encoder   iface.Tunable // nil when the codec has no runtime controls
+	framer    FrameSizer    // nil disables frame duration changes
+	clockRate uint32
+	red       RedundancySwitch // nil disables redundant audio
+	redCfg    config.RedConfig
+
+	loss          float64       // smoothed fraction lost 0..1
+	jitter        time.Duration // smoothed interarrival jitter
+	bitrate       int
+	fec           bool
+	lossPerc      int
+	frameDuration time.Duration
+	redDistance   int
+}
+
+// NewController creates a controller, encoders without runtime controls only get frame duration changes
+func NewController(cfg config.BitrateConfig, enc iface.Encoder, framer FrameSizer, clockRate uint32) *Controller {
+	tunable, _ := enc.(iface.Tunable)
+	return &Controller{
+		cfg:           cfg,
+		encoder:       tunable,
+		framer:        framer,
+		clockRate:     clockRate,
+		bitrate:       cfg.Start,
+		frameDuration: baseFrameDuration,
+	}
+}
+
+// WithRedundancy lets the controller switch redundant audio on when loss exceeds the configured threshold
+func (c *Controller) WithRedundancy(red RedundancySwitch, cfg config.RedConfig) *Controller {
+	c.red = red
+	c.redCfg = cfg
+	return c
+}
+
+// Run reads RTCP for the sender until it is closed and applies adaptations.
+// RTCP must be read even when adaptation is disabled so interceptors keep working.
+func (c *Controller) Run(sender *webrtc.RTPSender) {
+	defer log.Debug().Msg("Bitrate controller stopped")
+
+	if c.cfg.Enabled && c.encoder != nil {
+		if err := c.encoder.SetBitrate(c.bitrate); err != nil {
+			log.Warn().Err(err).Msg("Failed to set start bitrate")
+		}
+	}
+
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		ssrc := ssrcOf(sender)
+		for _, packet := range packets {
+			var reports []rtcp.ReceptionReport
+			switch p := packet.(type) {
+			case *rtcp.ReceiverReport:
+				reports = p.Reports
+			case *rtcp.SenderReport: // peer sends audio too, so reception blocks ride in its SR
+				reports = p.Reports
+			}
+			for _, report := range reports {
+				if report.SSRC != ssrc {
+					continue
+				}
+				c.OnReport(float64(report.FractionLost)/256, c.jitterDuration(report.Jitter))
+			}
+		}
+	}
+}
+
+// OnReport feeds one reception report into the controller
+func (c *Controller) OnReport(fractionLost float64, jitter time.Duration) {
+	c.loss = smooth(c.loss, fractionLost)
+	c.jitter = time.Duration(smooth(float64(c.jitter), float64(jitter)))
+
+	c.updateRedundancy()
+
+	if !c.cfg.Enabled {
+		return
+	}
+
+	bitrate := c.bitrate
+	frameDuration := c.frameDuration
+	congested := c.loss > lossHigh || c.jitter > jitterHigh
+	clean := c.loss < lossLow && c.jitter < jitterLow
+
+	switch {
+	case congested:
+		bitrate = max(int(float64(bitrate)*decrease), c.cfg.Min)
+		// at the floor fewer larger packets are the only way left to cut overhead
+		if bitrate == c.cfg.Min && frameDuration*2 <= c.cfg.MaxFrameDuration {
+			frameDuration *= 2
+		}
+	case clean:
+		bitrate = min(int(float64(bitrate)*increase), c.cfg.Max)
+		frameDuration = baseFrameDuration
+	}
+
+	fec := c.fec
+	if c.loss >= lossFECOn {
+		fec = true
+	} else if c.loss < lossFECOff {
+		fec = false
+	}
+	lossPerc := int(math.Round(c.loss * 100))
+
+	c.apply(bitrate, fec, lossPerc, frameDuration)
+}
+
+// apply pushes changed settings to the encoder and capture
+func (c *Controller) apply(bitrate int, fec bool, lossPerc int, frameDuration time.Duration) {
+	if c.encoder != nil {
+		if bitrate != c.bitrate {
+			if err := c.encoder.SetBitrate(bitrate); err != nil {
+				log.Warn().Err(err).Int("bitrate", bitrate).Msg("Failed to set bitrate")
+			} else {
+				c.bitrate = bitrate
+			}
+		}
+		if fec != c.fec {
+			if err := c.encoder.SetInBandFEC(fec); err != nil {
+				log.Warn().Err(err).Bool("fec", fec).Msg("Failed to switch FEC")
+			} else {
+				c.fec = fec
+			}
+		}
+		if lossPerc != c.lossPerc {
+			if err := c.encoder.SetPacketLossPerc(lossPerc); err != nil {
+				log.Warn().Err(err).Int("loss_perc", lossPerc).Msg("Failed to set expected loss")
+			} else {
+				c.lossPerc = lossPerc
+			}
+		}
+	}
+
+	if c.framer != nil && frameDuration != c.frameDuration {
+		if err := c.framer.SetFrameDuration(frameDuration); err != nil {
+			log.Warn().Err(err).Dur("frame", frameDuration).Msg("Failed to change frame duration")
+		} else {
+			c.frameDuration = frameDuration
+		}
+	}
+
+	log.Debug().
+		Float64("loss", c.loss).
+		Dur("jitter", c.jitter).
+		Int("bitrate", c.bitrate).
+		Bool("fec", c.fec).
+		Dur("frame", c.frameDuration).
+		Msg("Bitrate controller update")
+}
+
+// updateRedundancy enables RED above the loss threshold and drops it once loss halves,
+// FEC alone can't recover bursts on very lossy links
+func (c *Controller) updateRedundancy() {
+	if c.red == nil || !c.redCfg.Enabled {
+		return
+	}
+	distance := c.redDistance
+	if c.loss > c.redCfg.LossThreshold {
+		distance = c.redCfg.Distance
+	} else if c.loss < c.redCfg.LossThreshold/2 {
+		distance = 0
+	}
+	if distance != c.redDistance {
+		c.red.SetRedundancy(distance)
+		c.redDistance = distance
+	}
+}
+
+// Bitrate returns the bitrate currently applied to the encoder
+func (c *Controller) Bitrate() int {
+	return c.bitrate
+}
+
+// FrameDuration returns the frame duration currently applied to capture
+func (c *Controller) FrameDuration() time.Duration {
+	return c.frameDuration
+}
+
+// FEC reports whether in-band FEC is enabled
+func (c *Controller) FEC() bool {
+	return c.fec
+}
+
+func (c *Controller) jitterDuration(jitter uint32) time.Duration {
+	if c.clockRate == 0 {
+		return 0
+	}
+	return time.Duration(jitter) * time.Second / time.Duration(c.clockRate)
+}
+
+// smooth is an EWMA that reacts faster to degradation than to recovery
+func smooth(current, sample float64) float64 {
+	alpha := decayAlpha
+	if sample > current {
+		alpha = attackAlpha
+	}
+	return current + alpha*(sample-current)
+}
+
+func ssrcOf(sender *webrtc.RTPSender) uint32 {
+	encodings := sender.GetParameters().Encodings
+	if len(encodings) == 0 {
+		return 0
+	}
+	return uint32(encodings[0].SSRC)
+}
@@ -0,0 +1,119 @@
+package congestion
+
+import (
+	"p2p-call/pkg/config"
+	"testing"
+	"time"
+)
+
+type fakeEncoder struct {
+	bitrate  int
+	fec      bool
+	lossPerc int
+}
+
+func (f *fakeEncoder) Encode(pcm []int16) ([]byte, error) { return nil, nil }
+func (f *fakeEncoder) SetBitrate(bitrate int) error       { f.bitrate = bitrate; return nil }
+func (f *fakeEncoder) SetInBandFEC(enabled bool) error    { f.fec = enabled; return nil }
+func (f *fakeEncoder) SetPacketLossPerc(perc int) error   { f.lossPerc = perc; return nil }
+
+type fakeFramer struct {
+	duration time.Duration
+}
+
+func (f *fakeFramer) SetFrameDuration(d time.Duration) error { f.duration = d; return nil }
+
+func testConfig() config.BitrateConfig {
+	return config.BitrateConfig{
+		Enabled:          true,
+		Min:              12000,
+		Max:              64000,
+		Start:            32000,
+		MaxFrameDuration: 60 * time.Millisecond,
+	}
+}
+
+func TestHighLossReducesBitrateToFloor(t *testing.T) {
+	enc := &fakeEncoder{}
+	framer := &fakeFramer{}
+	c := NewController(testConfig(), enc, framer, 48000)
+
+	for i := 0; i < 30; i++ {
+		c.OnReport(0.3, 10*time.Millisecond)
+	}
+
+	if enc.bitrate != 12000 {
+		t.Errorf("expected bitrate at floor 12000, got %d", enc.bitrate)
+	}
+	if !enc.fec {
+		t.Error("expected FEC enabled under loss")
+	}
+	if enc.lossPerc < 20 {
+		t.Errorf("expected loss percentage near 30, got %d", enc.lossPerc)
+	}
+	if framer.duration != 40*time.Millisecond {
+		t.Errorf("expected frame duration to grow to 40ms, got %v", framer.duration)
+	}
+}
+
+func TestCleanLinkRecoversToCeiling(t *testing.T) {
+	enc := &fakeEncoder{}
+	framer := &fakeFramer{}
+	c := NewController(testConfig(), enc, framer, 48000)
+
+	for i := 0; i < 10; i++ {
+		c.OnReport(0.3, 80*time.Millisecond)
+	}
+	for i := 0; i < 200; i++ {
+		c.OnReport(0, time.Millisecond)
+	}
+
+	if enc.bitrate != 64000 {
+		t.Errorf("expected bitrate at ceiling 64000, got %d", enc.bitrate)
+	}
+	if enc.fec {
+		t.Error("expected FEC disabled on clean link")
+	}
+	if c.FrameDuration() != baseFrameDuration {
+		t.Errorf("expected frame duration back to %v, got %v", baseFrameDuration, c.FrameDuration())
+	}
+}
+
+func TestDisabledControllerKeepsSettings(t *testing.T) {
+	cfg := testConfig()
+	cfg.Enabled = false
+	enc := &fakeEncoder{}
+	c := NewController(cfg, enc, nil, 48000)
+
+	c.OnReport(0.5, 100*time.Millisecond)
+
+	if enc.bitrate != 0 || enc.fec {
+		t.Errorf("disabled controller changed encoder: %+v", enc)
+	}
+}
+
+type fakeRedundancy struct {
+	distance int
+}
+
+func (f *fakeRedundancy) SetRedundancy(distance int) { f.distance = distance }
+
+func TestRedundancyFollowsLossThreshold(t *testing.T) {
+	red := &fakeRedundancy{}
+	c := NewController(testConfig(), &fakeEncoder{}, nil, 48000).
+		WithRedundancy(red, config.RedConfig{Enabled: true, Distance: 2, LossThreshold: 0.1})
+
+	for i := 0; i < 10; i++ {
+		c.OnReport(0.25, 0)
+	}
+	if red.distance != 2 {
+		t.Fatalf("expected redundancy on above threshold, got distance %d", red.distance)
+	}
+
+	for i := 0; i < 100; i++ {
+		c.OnReport(0, 0)
+	}
+	if red.distance != 0 {
+		t.Errorf("expected redundancy off after recovery, got distance %d", red.distance)
+	}
+}
@@ -0,0 +1,118 @@
+package rtc
+
+import (
+	"context"
+	"fmt"
+	"p2p-call/internal/audio/capture"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const holdTimeout = 45 * time.Second // longer than the negotiator waits for an answer
+
+// holdState tracks hold in both directions
+type holdState struct {
+	mu       sync.Mutex
+	local    bool // we put the peer on hold
+	remote   bool // the peer put us on hold
+	changing bool // our hold or resume is being negotiated
+	onChange func(local, remote bool)
+}
+
+// Hold puts the peer on hold: we renegotiate sendonly and the peer stops sending,
+// the microphone is cut and hold music plays if enabled.
+func (con *Connection) Hold() error {
+	return con.setHold(true)
+}
+
+// Resume takes the call off hold
+func (con *Connection) Resume() error {
+	return con.setHold(false)
+}
+
+// setHold negotiates our hold state and applies it once the peer answered.
+// The lock is released while negotiating, the peer's offers arriving meanwhile need it.
+func (con *Connection) setHold(hold bool) error {
+	con.hold.mu.Lock()
+	switch {
+	case con.hold.local == hold:
+		con.hold.mu.Unlock()
+		return nil
+	case con.signal == nil:
+		con.hold.mu.Unlock()
+		return fmt.Errorf("call is not connected")
+	case con.hold.changing:
+		con.hold.mu.Unlock()
+		return fmt.Errorf("hold is already being changed")
+	}
+	con.hold.changing = true
+	con.hold.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), holdTimeout)
+	err := con.signal.SetHold(ctx, hold)
+	cancel()
+
+	con.hold.mu.Lock()
+	defer con.hold.mu.Unlock()
+	con.hold.changing = false
+	if err != nil {
+		if hold {
+			return fmt.Errorf("failed to put call on hold: %w", err)
+		}
+		return fmt.Errorf("failed to resume call: %w", err)
+	}
+	con.hold.local = hold
+
+	switch {
+	case hold && con.holdCfg.Music:
+		rate, channels := con.Pipeline.Capture.SampleRate()
+		con.Pipeline.Capture.SetHoldSource(capture.NewHoldMusic(rate, channels))
+	case !hold:
+		con.Pipeline.Capture.SetHoldSource(nil)
+	}
+	con.applyHoldLocked()
+	if hold {
+		log.Info().Bool("music", con.holdCfg.Music).Msg("Call on hold")
+	} else {
+		log.Info().Msg("Call resumed")
+	}
+	con.notifyHoldLocked()
+	return nil
+}
+
+// OnHoldChange sets the handler called when either side holds or resumes the call
+func (con *Connection) OnHoldChange(handler func(local, remote bool)) {
+	con.hold.mu.Lock()
+	con.hold.onChange = handler
+	con.hold.mu.Unlock()
+}
+
+// handleRemoteHold follows the direction of the peer's offers and answers
+func (con *Connection) handleRemoteHold(held bool) {
+	con.hold.mu.Lock()
+	defer con.hold.mu.Unlock()
+	if held == con.hold.remote {
+		return
+	}
+	con.hold.remote = held
+	con.applyHoldLocked()
+	log.Info().Bool("held", held).Msg("Remote hold changed")
+	con.notifyHoldLocked()
+}
+
+// applyHoldLocked cuts the microphone while either side holds, and stops sending while nobody
+// listens: the peer holds us and we answered without sending, or we hold it without music.
+func (con *Connection) applyHoldLocked() {
+	con.Pipeline.Capture.Suspend(con.hold.local || con.hold.remote)
+	if con.audioTrack != nil {
+		con.audioTrack.SetHeld(con.hold.remote || (con.hold.local && !con.holdCfg.Music))
+	}
+}
+
+func (con *Connection) notifyHoldLocked() {
+	if con.hold.onChange != nil {
+		go con.hold.onChange(con.hold.local, con.hold.remote)
+	}
+}
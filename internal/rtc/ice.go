@@ -0,0 +1,73 @@
+package rtc
+
+import (
+	"net"
+	"p2p-call/pkg/config"
+	"slices"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// applyICEPolicy restricts candidate gathering to what the configuration allows
+func applyICEPolicy(settingEngine *webrtc.SettingEngine, cfg config.ICEConfig) {
+	var networkTypes []webrtc.NetworkType
+	if cfg.TCP {
+		networkTypes = append(networkTypes, webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6)
+	}
+	if cfg.UDP {
+		networkTypes = append(networkTypes, webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6)
+	}
+	settingEngine.SetNetworkTypes(networkTypes)
+
+	if cfg.MDNS {
+		settingEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryAndGather)
+	}
+
+	if len(cfg.Interfaces) > 0 || len(cfg.Excluded) > 0 {
+		settingEngine.SetInterfaceFilter(func(name string) bool {
+			if slices.Contains(cfg.Excluded, name) {
+				return false
+			}
+			return len(cfg.Interfaces) == 0 || slices.Contains(cfg.Interfaces, name)
+		})
+	}
+
+	if len(cfg.AllowIPs) > 0 || len(cfg.DenyIPs) > 0 {
+		settingEngine.SetIPFilter(func(ip net.IP) bool {
+			if containsIP(cfg.DenyIPs, ip) {
+				return false
+			}
+			return len(cfg.AllowIPs) == 0 || containsIP(cfg.AllowIPs, ip)
+		})
+	}
+
+	log.Info().
+		Bool("relay_only", cfg.RelayOnly).
+		Bool("mdns", cfg.MDNS).
+		Bool("udp", cfg.UDP).
+		Bool("tcp", cfg.TCP).
+		Msg("ICE policy")
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTurnServer reports whether any configured server has an address
+func hasTurnServer(servers []webrtc.ICEServer) bool {
+	for _, server := range servers {
+		for _, url := range server.URLs {
+			if url != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package latency
+
+import "time"
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the unix epoch
+const ntpEpochOffset = 2208988800
+
+// Breakdown is the mouth-to-ear delay of the audio we hear, split by where it is spent.
+// The peer's capture can't be measured from here, our own stands in for it.
+type Breakdown struct {
+	Capture  time.Duration // device period plus samples gathered into a frame before encoding
+	Network  time.Duration // sender to receiver one-way delay
+	Buffer   time.Duration // decoded audio waiting in the playback buffer
+	Playback time.Duration // playback device period
+	RTT      time.Duration
+	Measured bool // Network comes from sender reports, otherwise it is half the RTT
+}
+
+// Total is the estimated mouth-to-ear delay
+func (b Breakdown) Total() time.Duration {
+	return b.Capture + b.Network + b.Buffer + b.Playback
+}
+
+// Mapping ties an RTP timestamp to the sender's wall clock, taken from an RTCP sender report
+type Mapping struct {
+	NTP       time.Time
+	RTP       uint32
+	ClockRate uint32
+}
+
+// SendTime returns the sender's wall clock time for an RTP timestamp
+func (m Mapping) SendTime(timestamp uint32) time.Time {
+	ticks := int64(int32(timestamp - m.RTP)) // wraps around like RTP timestamps do
+	return m.NTP.Add(time.Duration(ticks) * time.Second / time.Duration(m.ClockRate))
+}
+
+// NTPTime converts a 32.32 fixed point NTP timestamp to time
+func NTPTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	fraction := int64(ntp&0xffffffff) * int64(time.Second) >> 32
+	return time.Unix(seconds, fraction)
+}
+
+// OneWay estimates the network delay of a packet from its arrival and the sender's clock.
+// The result is only trusted when it fits into the RTT, otherwise the clocks of both hosts
+// differ and half the RTT is returned with measured false.
+func OneWay(m Mapping, timestamp uint32, arrival time.Time, rtt time.Duration) (delay time.Duration, measured bool) {
+	if m.ClockRate != 0 && !m.NTP.IsZero() {
+		delay = arrival.Sub(m.SendTime(timestamp))
+		if delay >= 0 && delay <= rtt {
+			return delay, true
+		}
+	}
+	return rtt / 2, false
+}
@@ -0,0 +1,64 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNTPTime(t *testing.T) {
+	// 2024-01-01 00:00:00.5 UTC
+	ntp := uint64(1704067200+ntpEpochOffset)<<32 | 1<<31
+	want := time.Date(2024, 1, 1, 0, 0, 0, int(500*time.Millisecond), time.UTC)
+	if got := NTPTime(ntp); !got.Equal(want) {
+		t.Fatalf("NTPTime = %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestSendTimeWraps(t *testing.T) {
+	sent := time.Unix(1000, 0)
+	reported := uint32(0xffffff00)
+	m := Mapping{NTP: sent, RTP: reported, ClockRate: 48000}
+
+	if got := m.SendTime(reported + 960); !got.Equal(sent.Add(20 * time.Millisecond)) {
+		t.Errorf("timestamp after wrap = %v, want 20ms after the report", got.Sub(sent))
+	}
+	if got := m.SendTime(reported - 480); !got.Equal(sent.Add(-10 * time.Millisecond)) {
+		t.Errorf("timestamp before report = %v, want 10ms before it", got.Sub(sent))
+	}
+}
+
+func TestOneWay(t *testing.T) {
+	sent := time.Unix(1000, 0)
+	m := Mapping{NTP: sent, RTP: 8000, ClockRate: 8000}
+	rtt := 100 * time.Millisecond
+
+	// packet sent 1s after the report, arrived 30ms later on a synchronised clock
+	delay, measured := OneWay(m, 16000, sent.Add(1030*time.Millisecond), rtt)
+	if !measured || delay != 30*time.Millisecond {
+		t.Errorf("synchronised clocks: got %v measured %v, want 30ms measured", delay, measured)
+	}
+
+	// receiver clock two seconds behind, the measurement can't be trusted
+	delay, measured = OneWay(m, 16000, sent.Add(-970*time.Millisecond), rtt)
+	if measured || delay != rtt/2 {
+		t.Errorf("skewed clocks: got %v measured %v, want half the RTT", delay, measured)
+	}
+
+	delay, measured = OneWay(Mapping{}, 16000, sent, rtt)
+	if measured || delay != rtt/2 {
+		t.Errorf("no sender report: got %v measured %v, want half the RTT", delay, measured)
+	}
+}
+
+func TestBreakdownTotal(t *testing.T) {
+	b := Breakdown{
+		Capture:  30 * time.Millisecond,
+		Network:  40 * time.Millisecond,
+		Buffer:   60 * time.Millisecond,
+		Playback: 10 * time.Millisecond,
+		RTT:      80 * time.Millisecond,
+	}
+	if got := b.Total(); got != 140*time.Millisecond {
+		t.Fatalf("Total = %v, want 140ms", got)
+	}
+}
@@ -0,0 +1,106 @@
+package rtc
+
+import (
+	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/metrics"
+	"p2p-call/internal/rtc/latency"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const latencyInterval = 2 * time.Second
+
+// latencyMonitor combines RTCP timing with local buffering into a mouth-to-ear estimate
+type latencyMonitor struct {
+	mu        sync.Mutex
+	clockRate uint32
+	mapping   latency.Mapping // from the newest sender report
+	current   latency.Breakdown
+	valid     bool
+}
+
+func newLatencyMonitor() *latencyMonitor {
+	return &latencyMonitor{}
+}
+
+func (m *latencyMonitor) setClockRate(clockRate uint32) {
+	m.mu.Lock()
+	m.clockRate = clockRate
+	m.mu.Unlock()
+}
+
+// readReports takes the sender reports of the remote track, which map its RTP clock to wall clock time
+func (m *latencyMonitor) readReports(receiver *webrtc.RTPReceiver) {
+	for {
+		packets, _, err := receiver.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			report, ok := packet.(*rtcp.SenderReport)
+			if !ok {
+				continue
+			}
+			m.mu.Lock()
+			m.mapping = latency.Mapping{
+				NTP:       latency.NTPTime(report.NTPTime),
+				RTP:       report.RTPTime,
+				ClockRate: m.clockRate,
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// run updates the estimate until the connection closes
+func (m *latencyMonitor) run(pc *webrtc.PeerConnection, audio *pipeline.AudioPipeline) {
+	ticker := time.NewTicker(latencyInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		arrival := audio.LastArrival()
+		if arrival == nil {
+			continue
+		}
+
+		var b latency.Breakdown
+		for _, stat := range pc.GetStats() {
+			if remote, ok := stat.(webrtc.RemoteInboundRTPStreamStats); ok {
+				b.RTT = time.Duration(remote.RoundTripTime * float64(time.Second))
+			}
+		}
+		device, accumulation := audio.Capture.Latency()
+		b.Capture = device + accumulation
+		b.Buffer = audio.Playback.Buffered()
+		b.Playback = audio.Playback.DevicePeriod()
+
+		m.mu.Lock()
+		b.Network, b.Measured = latency.OneWay(m.mapping, arrival.Timestamp, arrival.At, b.RTT)
+		m.current = b
+		m.valid = true
+		m.mu.Unlock()
+
+		metrics.SetLatency(b.Capture, b.Network, b.Buffer, b.Playback)
+		log.Debug().
+			Dur("total", b.Total()).
+			Dur("capture", b.Capture).
+			Dur("network", b.Network).
+			Bool("measured", b.Measured).
+			Dur("buffer", b.Buffer).
+			Dur("playback", b.Playback).
+			Msg("Mouth-to-ear latency")
+	}
+}
+
+func (m *latencyMonitor) breakdown() (latency.Breakdown, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, m.valid
+}
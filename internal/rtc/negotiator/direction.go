@@ -0,0 +1,86 @@
+package negotiator
+
+import (
+	_ "unsafe" // go:linkname
+
+	"github.com/pion/webrtc/v4"
+)
+
+// setTransceiverDirection is RTPTransceiver.setDirection: pion v4 has no public setter for the
+// direction a transceiver offers or answers with, RTCRtpTransceiver.direction in the browser API.
+//
+//go:linkname setTransceiverDirection github.com/pion/webrtc/v4.(*RTPTransceiver).setDirection
+func setTransceiverDirection(t *webrtc.RTPTransceiver, direction webrtc.RTPTransceiverDirection)
+
+// holdDirection is the direction we offer with our hold state. Holding is sendonly even without
+// hold music, pion stops the answerer's transceiver on an inactive offer; the holder just sends nothing.
+func holdDirection(hold bool) webrtc.RTPTransceiverDirection {
+	if hold {
+		return webrtc.RTPTransceiverDirectionSendonly
+	}
+	return webrtc.RTPTransceiverDirectionSendrecv
+}
+
+// answerDirection answers offered with as much of want as the offer allows
+func answerDirection(want, offered webrtc.RTPTransceiverDirection) webrtc.RTPTransceiverDirection {
+	return directionOf(sends(want) && receives(offered), receives(want) && sends(offered))
+}
+
+func directionOf(send, recv bool) webrtc.RTPTransceiverDirection {
+	switch {
+	case send && recv:
+		return webrtc.RTPTransceiverDirectionSendrecv
+	case send:
+		return webrtc.RTPTransceiverDirectionSendonly
+	case recv:
+		return webrtc.RTPTransceiverDirectionRecvonly
+	default:
+		return webrtc.RTPTransceiverDirectionInactive
+	}
+}
+
+func sends(d webrtc.RTPTransceiverDirection) bool {
+	return d == webrtc.RTPTransceiverDirectionSendrecv || d == webrtc.RTPTransceiverDirectionSendonly
+}
+
+func receives(d webrtc.RTPTransceiverDirection) bool {
+	return d == webrtc.RTPTransceiverDirectionSendrecv || d == webrtc.RTPTransceiverDirectionRecvonly
+}
+
+// audioDirection returns the direction of the audio section in desc, sendrecv when it has none
+func audioDirection(desc *webrtc.SessionDescription) webrtc.RTPTransceiverDirection {
+	if desc == nil {
+		return webrtc.RTPTransceiverDirectionSendrecv
+	}
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return webrtc.RTPTransceiverDirectionSendrecv
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != webrtc.RTPCodecTypeAudio.String() {
+			continue
+		}
+		for _, attr := range media.Attributes {
+			if d := webrtc.NewRTPTransceiverDirection(attr.Key); d != webrtc.RTPTransceiverDirectionUnknown {
+				return d
+			}
+		}
+		break
+	}
+	return webrtc.RTPTransceiverDirectionSendrecv
+}
+
+// remoteHolds reports whether the peer holds the call in its offer or answer desc.
+// Our offers always send, so a peer that doesn't receive holds in answers as well as in offers.
+func remoteHolds(desc *webrtc.SessionDescription) bool {
+	return !receives(audioDirection(desc))
+}
+
+// setAudioDirection sets the direction of our audio transceivers for the next offer or answer
+func (n *Negotiator) setAudioDirection(direction webrtc.RTPTransceiverDirection) {
+	for _, t := range n.pc.GetTransceivers() {
+		if t.Kind() == webrtc.RTPCodecTypeAudio {
+			setTransceiverDirection(t, direction)
+		}
+	}
+}
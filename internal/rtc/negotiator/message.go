@@ -10,19 +10,22 @@ import (
 type SignalMessageType string
 
 const (
-	Handshake SignalMessageType = "handshake"
-	Ack       SignalMessageType = "ack"
-	Offer     SignalMessageType = "offer"
-	Answer    SignalMessageType = "answer"
-	SimpleMsg SignalMessageType = "simple_msg"
-	ErrorMsg  SignalMessageType = "error_msg"
+	Handshake   SignalMessageType = "handshake"
+	Ack         SignalMessageType = "ack"
+	Offer       SignalMessageType = "offer"
+	Answer      SignalMessageType = "answer"
+	Renegotiate SignalMessageType = "renegotiate" // asks the peer that makes the offers for a new one
+	SimpleMsg   SignalMessageType = "simple_msg"
+	ErrorMsg    SignalMessageType = "error_msg"
 )
 
 type Message struct {
-	Type      SignalMessageType          `json:"type"`
-	SDP       *webrtc.SessionDescription `json:"sdp,omitempty"`
-	Candidate *webrtc.ICECandidate       `json:"candidate,omitempty"`
-	SessionID string                     `json:"session_id"`
+	Type       SignalMessageType          `json:"type"`
+	SDP        *webrtc.SessionDescription `json:"sdp,omitempty"`
+	Candidate  *webrtc.ICECandidate       `json:"candidate,omitempty"`
+	SessionID  string                     `json:"session_id"`
+	Requested  bool                       `json:"requested,omitempty"`   // the offer is made for a renegotiate message
+	ICERestart bool                       `json:"ice_restart,omitempty"` // a renegotiate message asks for an ICE restart
 }
 
 func (msg *Message) ToBytes() []byte {
@@ -3,6 +3,7 @@ package negotiator
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pion/webrtc/v4"
@@ -10,19 +11,25 @@ import (
 )
 
 type Negotiator struct {
-	pc         *webrtc.PeerConnection
-	offerChan  chan Message
-	answerChan chan Message
-	stream     *StreamHandler
+	pc              *webrtc.PeerConnection
+	offerChan       chan Message
+	answerChan      chan Message
+	renegotiateChan chan *renegotiation
+	requestChan     chan Message
+	stream          *StreamHandler
+
+	OnRemoteHold HoldCallBack // called with the hold state of every renegotiation offer or answer received
 }
 
 // NewNegotiator creates a new Negotiator instance
 func NewNegotiator(pc *webrtc.PeerConnection, stream *StreamHandler) *Negotiator {
 	return &Negotiator{
-		pc:         pc,
-		offerChan:  make(chan Message),
-		answerChan: make(chan Message, 1),
-		stream:     stream,
+		pc:              pc,
+		offerChan:       make(chan Message, 1),
+		answerChan:      make(chan Message, 1),
+		renegotiateChan: make(chan *renegotiation),
+		requestChan:     make(chan Message, 1),
+		stream:          stream,
 	}
 }
 
@@ -43,6 +50,14 @@ func (n *Negotiator) SetupCallbacks() {
 			log.Warn().Msg("Answer channel full")
 		}
 	}
+
+	n.stream.OnRenegotiate = func(msg Message) {
+		select {
+		case n.requestChan <- msg:
+		default:
+			log.Warn().Msg("Renegotiation request channel full")
+		}
+	}
 }
 
 func (n *Negotiator) CreateOffer(ctx context.Context) error {
@@ -83,7 +98,7 @@ func (n *Negotiator) AcceptOffer(ctx context.Context) error {
 
 	select {
 	case offer := <-n.offerChan:
-		return n.processOffer(offer)
+		return n.processOffer(offer, false)
 	case <-time.After(30 * time.Second):
 		return fmt.Errorf("timeout waiting for offer")
 	case <-ctx.Done():
@@ -91,10 +106,13 @@ func (n *Negotiator) AcceptOffer(ctx context.Context) error {
 	}
 }
 
-func (n *Negotiator) processOffer(offer Message) error {
+// processOffer answers the offer with the direction our hold state allows
+func (n *Negotiator) processOffer(offer Message, hold bool) error {
 	if err := n.pc.SetRemoteDescription(*offer.SDP); err != nil {
 		return fmt.Errorf("failed to set remote description: %w", err)
 	}
+	direction := answerDirection(holdDirection(hold), audioDirection(offer.SDP))
+	n.setAudioDirection(direction)
 
 	answer, err := n.pc.CreateAnswer(nil)
 	if err != nil {
@@ -116,7 +134,7 @@ func (n *Negotiator) processOffer(offer Message) error {
 	}
 
 	n.stream.SendMessage(answerMsg)
-	log.Info().Msg("Answer sent")
+	log.Info().Str("direction", direction.String()).Msg("Answer sent")
 	return nil
 }
 
@@ -130,14 +148,20 @@ func (n *Negotiator) processAnswer(answer Message) error {
 
 func (n *Negotiator) waitForICEGathering() {
 	done := make(chan struct{})
+	var once sync.Once
 
 	n.pc.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
 		log.Info().Str("state", state.String()).Msg("ICE gathering state")
 		if state == webrtc.ICEGatheringStateComplete {
-			close(done)
+			once.Do(func() { close(done) })
 		}
 	})
 
+	// renegotiation keeps the ICE session, candidates were gathered already
+	if n.pc.ICEGatheringState() == webrtc.ICEGatheringStateComplete {
+		return
+	}
+
 	select {
 	case <-done:
 		log.Info().Msg("ICE candidates gathered")
@@ -0,0 +1,213 @@
+package negotiator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const answerTimeout = 30 * time.Second
+
+var ErrRenegotiationTimeout = errors.New("timeout waiting for answer")
+
+// HoldCallBack is called with the hold state of the peer's offers and answers
+type HoldCallBack func(held bool)
+
+// renegotiation is a request for a new offer
+type renegotiation struct {
+	hold       *bool // hold state to send, nil keeps the current one
+	iceRestart bool
+	remote     bool       // asked for by the peer
+	done       chan error // nil for requests of the peer
+}
+
+func (r *renegotiation) finish(err error) {
+	if r.done != nil {
+		r.done <- err
+	}
+}
+
+// SetHold renegotiates the call with us holding it or not and waits until the peer accepted it.
+// Only valid after the initial negotiation completed and Serve is running.
+func (n *Negotiator) SetHold(ctx context.Context, hold bool) error {
+	return n.renegotiate(ctx, &renegotiation{hold: &hold})
+}
+
+// RestartICE renegotiates the call with new ICE credentials so candidates are gathered again
+func (n *Negotiator) RestartICE(ctx context.Context) error {
+	return n.renegotiate(ctx, &renegotiation{iceRestart: true})
+}
+
+func (n *Negotiator) renegotiate(ctx context.Context, req *renegotiation) error {
+	req.done = make(chan error, 1)
+	select {
+	case n.renegotiateChan <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Serve handles renegotiation after the initial negotiation, offerer is true on the peer that made
+// the first offer. pion v4 rejects rollback from have-local-offer and have-remote-offer alike, so glare
+// can't be resolved and offers must never collide: only the offerer makes them, the other peer sends
+// a renegotiate request instead and the offerer offers for it. Requests are queued and handled one at
+// a time. Hold is the direction of the audio section, the holder offers or answers without receiving.
+// OnRemoteHold runs outside the loop so a handler waiting for our own renegotiation can't stall it.
+func (n *Negotiator) Serve(ctx context.Context, offerer bool) {
+	var (
+		queue   []*renegotiation
+		pending *renegotiation // offered or requested, waiting for the peer
+		timeout <-chan time.Time
+		holding bool // hold state the peer last accepted from us
+	)
+
+	remoteHold := make(chan bool, 8)
+	defer close(remoteHold)
+	go func() {
+		for held := range remoteHold {
+			if n.OnRemoteHold != nil {
+				n.OnRemoteHold(held)
+			}
+		}
+	}()
+	notify := func(held bool) bool {
+		select {
+		case remoteHold <- held:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// next sends the first queued request while nothing is pending
+	next := func() {
+		for pending == nil && len(queue) > 0 {
+			req := queue[0]
+			queue = queue[1:]
+			hold := holding
+			if req.hold != nil {
+				hold = *req.hold
+			}
+			var err error
+			if offerer {
+				err = n.sendOffer(hold, req.iceRestart, req.remote)
+			} else {
+				err = n.sendRequest(req.iceRestart)
+			}
+			if err != nil {
+				req.finish(err)
+				continue
+			}
+			pending, timeout = req, time.After(answerTimeout)
+		}
+	}
+	done := func(err error) {
+		pending.finish(err)
+		pending, timeout = nil, nil
+		next()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case req := <-n.renegotiateChan:
+			queue = append(queue, req)
+			next()
+
+		case msg := <-n.requestChan:
+			if !offerer {
+				log.Warn().Msg("Ignoring renegotiation request, the peer makes the offers")
+				continue
+			}
+			queue = append(queue, &renegotiation{iceRestart: msg.ICERestart, remote: true})
+			next()
+
+		case answer := <-n.answerChan:
+			if pending == nil || !offerer {
+				log.Warn().Msg("Ignoring unexpected answer")
+				continue
+			}
+			err := n.processAnswer(answer)
+			if err == nil {
+				if pending.hold != nil {
+					holding = *pending.hold
+				}
+				if !notify(remoteHolds(answer.SDP)) {
+					return
+				}
+			}
+			done(err)
+
+		case remote := <-n.offerChan:
+			if offerer {
+				log.Warn().Msg("Ignoring offer, renegotiation offers are ours to make")
+				continue
+			}
+			// the offer made for our request carries the answer with our new hold state
+			requested := remote.Requested && pending != nil
+			hold := holding
+			if requested && pending.hold != nil {
+				hold = *pending.hold
+			}
+			if err := n.processOffer(remote, hold); err != nil {
+				log.Error().Err(err).Msg("Failed to process renegotiation offer")
+				continue
+			}
+			if !notify(remoteHolds(remote.SDP)) {
+				return
+			}
+			if requested {
+				holding = hold
+				done(nil)
+			}
+
+		case <-timeout:
+			done(ErrRenegotiationTimeout)
+		}
+	}
+}
+
+// sendOffer offers with the direction of our hold state
+func (n *Negotiator) sendOffer(hold, iceRestart, requested bool) error {
+	n.setAudioDirection(holdDirection(hold))
+	offer, err := n.pc.CreateOffer(&webrtc.OfferOptions{ICERestart: iceRestart})
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+	if err := n.pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	n.waitForICEGathering()
+
+	n.stream.SendMessage(Message{
+		Type:      Offer,
+		SDP:       n.pc.LocalDescription(),
+		SessionID: n.stream.sessionID,
+		Requested: requested,
+	})
+	log.Info().Bool("hold", hold).Bool("ice_restart", iceRestart).Msg("Renegotiation offer sent")
+	return nil
+}
+
+// sendRequest asks the offerer for a new offer
+func (n *Negotiator) sendRequest(iceRestart bool) error {
+	n.stream.SendMessage(Message{
+		Type:       Renegotiate,
+		SessionID:  n.stream.sessionID,
+		ICERestart: iceRestart,
+	})
+	log.Info().Bool("ice_restart", iceRestart).Msg("Renegotiation requested")
+	return nil
+}
@@ -0,0 +1,290 @@
+package negotiator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+func newTestNegotiator(t *testing.T) *Negotiator {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, "audio", "microphone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	n := NewNegotiator(pc, NewStreamHandler("test", nil))
+	n.SetupCallbacks()
+	return n
+}
+
+// pump delivers what from sends to to, like the p2p stream. Locking gate holds messages back
+// once they were taken.
+func pump(ctx context.Context, from, to *Negotiator, gate *sync.RWMutex, taken *atomic.Int32) {
+	for {
+		select {
+		case msg := <-from.stream.outgoingChan:
+			taken.Add(1)
+			gate.RLock()
+			to.stream.routeMessage(msg)
+			gate.RUnlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type testPeers struct {
+	a, b         *Negotiator // a makes the offers
+	aHeld, bHeld chan bool   // hold state each side sees from the other
+	gate         sync.RWMutex
+	fromB        atomic.Int32 // messages b sent
+}
+
+// connectPeers negotiates two negotiators back to back and starts serving,
+// setup runs before the first offer
+func connectPeers(t *testing.T, ctx context.Context, setup ...func(a, b *Negotiator)) *testPeers {
+	t.Helper()
+	p := &testPeers{a: newTestNegotiator(t), b: newTestNegotiator(t)}
+	a, b := p.a, p.b
+	for _, f := range setup {
+		f(a, b)
+	}
+	var fromA atomic.Int32
+	go pump(ctx, a, b, &p.gate, &fromA)
+	go pump(ctx, b, a, &p.gate, &p.fromB)
+
+	errs := make(chan error, 2)
+	go func() { errs <- a.CreateOffer(ctx) }()
+	go func() { errs <- b.AcceptOffer(ctx) }()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.aHeld, p.bHeld = make(chan bool, 8), make(chan bool, 8)
+	a.OnRemoteHold = func(held bool) { p.aHeld <- held }
+	b.OnRemoteHold = func(held bool) { p.bHeld <- held }
+	go a.Serve(ctx, true)
+	go b.Serve(ctx, false)
+	return p
+}
+
+// expectHeld waits until the remote hold state seen is want, every offer and answer repeats it
+func expectHeld(t *testing.T, held chan bool, want bool) {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case got := <-held:
+			if got == want {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("remote hold %v not seen", want)
+		}
+	}
+}
+
+// expectDirections checks the audio direction each peer last offered or answered
+func expectDirections(t *testing.T, a, b webrtc.RTPTransceiverDirection, p *testPeers) {
+	t.Helper()
+	for _, side := range []struct {
+		n    *Negotiator
+		want webrtc.RTPTransceiverDirection
+	}{{p.a, a}, {p.b, b}} {
+		desc := side.n.pc.CurrentLocalDescription()
+		if desc == nil || !strings.Contains(desc.SDP, "a="+side.want.String()+"\r\n") {
+			t.Errorf("local description not %s: %v", side.want, desc)
+		}
+	}
+}
+
+func TestHoldAndResume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p := connectPeers(t, ctx)
+
+	if err := p.a.SetHold(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, p.bHeld, true)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendonly, webrtc.RTPTransceiverDirectionRecvonly, p)
+
+	// b holds and resumes through a request, a keeps holding in the offers made for it
+	if err := p.b.SetHold(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, p.aHeld, true)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendonly, webrtc.RTPTransceiverDirectionInactive, p)
+	if err := p.b.SetHold(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, p.aHeld, false)
+	expectHeld(t, p.bHeld, true)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendonly, webrtc.RTPTransceiverDirectionRecvonly, p)
+
+	if err := p.a.SetHold(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, p.bHeld, false)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendrecv, webrtc.RTPTransceiverDirectionSendrecv, p)
+
+	// b answers sendonly while only b holds
+	if err := p.b.SetHold(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	expectHeld(t, p.aHeld, true)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendrecv, webrtc.RTPTransceiverDirectionSendonly, p)
+}
+
+func TestHoldGlare(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p := connectPeers(t, ctx)
+
+	// b's handler waits for b's own hold to finish, which needs b to keep serving
+	var mu sync.Mutex
+	bHeld := make(chan bool, 8)
+	p.b.OnRemoteHold = func(held bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		bHeld <- held
+	}
+
+	// both hold at once: a's offer and b's request cross
+	p.gate.Lock()
+	sentByB := p.fromB.Load()
+	errs := make(chan error, 2)
+	go func() { errs <- p.a.SetHold(ctx, true) }()
+	go func() {
+		mu.Lock()
+		defer mu.Unlock()
+		errs <- p.b.SetHold(ctx, true)
+	}()
+	for p.a.pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer || p.fromB.Load() == sentByB {
+		if ctx.Err() != nil {
+			p.gate.Unlock()
+			t.Fatal("offer and request not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	p.gate.Unlock()
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHeld(t, p.aHeld, true)
+	expectHeld(t, bHeld, true)
+	expectDirections(t, webrtc.RTPTransceiverDirectionSendonly, webrtc.RTPTransceiverDirectionInactive, p)
+}
+
+// Serve avoids glare instead of rolling back because pion refuses it,
+// this fails once pion supports rollback
+func TestRollbackRejected(t *testing.T) {
+	local, remote := newTestNegotiator(t).pc, newTestNegotiator(t).pc
+	offer, err := local.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	rollback := webrtc.SessionDescription{Type: webrtc.SDPTypeRollback, SDP: offer.SDP}
+	if err := local.SetLocalDescription(rollback); err == nil {
+		t.Error("rollback of the local offer accepted")
+	}
+	if err := remote.SetRemoteDescription(rollback); err == nil {
+		t.Error("rollback of the remote offer accepted")
+	}
+}
+
+func TestRestartICE(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p := connectPeers(t, ctx)
+
+	// either side can restart, the offers always come from a
+	for _, n := range []*Negotiator{p.a, p.b} {
+		before := iceUfrag(p.b.pc.CurrentRemoteDescription())
+		if err := n.RestartICE(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if after := iceUfrag(p.b.pc.CurrentRemoteDescription()); after == "" || after == before {
+			t.Errorf("ice-ufrag %q after restart, was %q", after, before)
+		}
+	}
+}
+
+func iceUfrag(desc *webrtc.SessionDescription) string {
+	if desc == nil {
+		return ""
+	}
+	for _, line := range strings.Split(desc.SDP, "\r\n") {
+		if ufrag, ok := strings.CutPrefix(line, "a=ice-ufrag:"); ok {
+			return ufrag
+		}
+	}
+	return ""
+}
+
+// the held side's receiver stops when the answer leaves out sending, resuming starts a new one
+func TestMediaResumesAfterHold(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tracks := make(chan *webrtc.TrackRemote, 4)
+	p := connectPeers(t, ctx, func(a, b *Negotiator) {
+		a.pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) { tracks <- track })
+	})
+	sample := p.b.pc.GetSenders()[0].Track().(*webrtc.TrackLocalStaticSample)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for ctx.Err() == nil {
+			sample.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			<-ticker.C
+		}
+	}()
+	expectPacket := func() {
+		t.Helper()
+		select {
+		case track := <-tracks:
+			if _, _, err := track.ReadRTP(); err != nil {
+				t.Fatal(err)
+			}
+		case <-ctx.Done():
+			t.Fatal("no track received")
+		}
+	}
+
+	expectPacket()
+	if err := p.a.SetHold(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.a.SetHold(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket()
+}
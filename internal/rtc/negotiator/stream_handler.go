@@ -15,14 +15,16 @@ import (
 type HandshakeCallBack func()
 type OfferCallBack func(msg Message)
 type AnswerCallBack func(msg Message)
+type RenegotiateCallBack func(msg Message)
 
 type StreamHandler struct {
-	incomingChan chan Message      // channel for incoming messages via p2plib
-	outgoingChan chan Message      // channel for outgoing messages via p2plib
-	onHandshake  HandshakeCallBack // function called on handshake complete
-	OnOffer      OfferCallBack     // function called on offer received
-	OnAnswer     AnswerCallBack    // function called on answer received
-	sessionID    string            // webrtc session id
+	incomingChan  chan Message        // channel for incoming messages via p2plib
+	outgoingChan  chan Message        // channel for outgoing messages via p2plib
+	onHandshake   HandshakeCallBack   // function called on handshake complete
+	OnOffer       OfferCallBack       // function called on offer received
+	OnAnswer      AnswerCallBack      // function called on answer received
+	OnRenegotiate RenegotiateCallBack // function called on renegotiation request received
+	sessionID     string              // webrtc session id
 }
 
 func NewStreamHandler(sessionID string, onHandShake HandshakeCallBack) *StreamHandler {
@@ -137,6 +139,12 @@ func (sh *StreamHandler) routeMessage(msg Message) {
 			sh.OnAnswer(msg)
 		}
 
+	case Renegotiate:
+		log.Info().Msg("Received renegotiation request")
+		if sh.OnRenegotiate != nil {
+			sh.OnRenegotiate(msg)
+		}
+
 	default:
 		sh.incomingChan <- msg
 	}
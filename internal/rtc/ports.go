@@ -0,0 +1,65 @@
+package rtc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"p2p-call/pkg/config"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// applyPortConfig pins candidates to fixed ports and opens the shared listeners,
+// returned closers release the listeners when the connection ends
+func applyPortConfig(settingEngine *webrtc.SettingEngine, cfg config.PortConfig) ([]io.Closer, error) {
+	if cfg.UDPPortMin != 0 {
+		if err := settingEngine.SetEphemeralUDPPortRange(uint16(cfg.UDPPortMin), uint16(cfg.UDPPortMax)); err != nil {
+			return nil, fmt.Errorf("failed to set UDP port range: %w", err)
+		}
+		log.Info().Int("min", cfg.UDPPortMin).Int("max", cfg.UDPPortMax).Msg("ICE UDP port range")
+	}
+
+	if len(cfg.NAT1To1IPs) > 0 {
+		candidateType := webrtc.ICECandidateTypeHost
+		if cfg.NAT1To1Srflx {
+			candidateType = webrtc.ICECandidateTypeSrflx
+		}
+		settingEngine.SetNAT1To1IPs(cfg.NAT1To1IPs, candidateType)
+		log.Info().Strs("ips", cfg.NAT1To1IPs).Str("candidate", candidateType.String()).Msg("NAT 1:1 mapping")
+	}
+
+	var closers []io.Closer
+	if cfg.UDPMuxPort != 0 {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: cfg.UDPMuxPort})
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on UDP mux port %d: %w", cfg.UDPMuxPort, err)
+		}
+		mux := ice.NewUDPMuxDefault(ice.UDPMuxParams{UDPConn: conn})
+		settingEngine.SetICEUDPMux(mux)
+		closers = append(closers, mux)
+		log.Info().Int("port", cfg.UDPMuxPort).Msg("ICE UDP mux listening")
+	}
+
+	if cfg.TCPPort != 0 {
+		listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: cfg.TCPPort})
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("failed to listen on ICE-TCP port %d: %w", cfg.TCPPort, err)
+		}
+		mux := ice.NewTCPMuxDefault(ice.TCPMuxParams{Listener: listener, ReadBufferSize: 8})
+		settingEngine.SetICETCPMux(mux)
+		closers = append(closers, mux)
+		log.Info().Int("port", cfg.TCPPort).Msg("ICE-TCP listening")
+	}
+	return closers, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Debug().Err(err).Msg("Failed to close ICE listener")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package quality
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Simplified ITU-T G.107 E-model: R = R0 - Id - Ie,eff, mapped to MOS.
+// Only the terms that change during a call are modelled, the rest are G.107 defaults.
+
+const (
+	baseR = 93.2 // R0 - Is with default G.107 parameters
+
+	// WarnMOS is the score below which users start to notice degraded quality
+	WarnMOS = 3.5
+
+	codecDelay = 10 * time.Millisecond // encoder lookahead and packetisation not covered by RTT
+)
+
+// Impairment are the codec constants of the E-model
+type Impairment struct {
+	Ie  float64 // equipment impairment without loss
+	Bpl float64 // robustness against packet loss, higher hides loss better
+}
+
+// CodecImpairment returns E-model constants for a negotiated mime type
+func CodecImpairment(mimeType string) Impairment {
+	switch strings.ToLower(mimeType) {
+	case "audio/opus":
+		return Impairment{Ie: 0, Bpl: 20} // wideband codec with PLC and in-band FEC
+	case "audio/pcmu", "audio/pcma":
+		return Impairment{Ie: 0, Bpl: 4.3} // G.113 value for G.711 without PLC
+	default:
+		return Impairment{Ie: 10, Bpl: 10}
+	}
+}
+
+// Sample is the network state measured over one interval
+type Sample struct {
+	Delay  time.Duration // one way mouth to ear delay without jitter buffering
+	Jitter time.Duration
+	Loss   float64 // lost or concealed fraction 0..1
+}
+
+// Score is the estimated quality of one interval
+type Score struct {
+	R   float64 // transmission rating 0..100
+	MOS float64 // mean opinion score 1..4.5
+}
+
+// Estimate computes the score for a sample sent with a codec
+func Estimate(codec Impairment, s Sample) Score {
+	// the jitter buffer has to hold about two jitter periods
+	d := float64(s.Delay+2*s.Jitter+codecDelay) / float64(time.Millisecond)
+	id := 0.024 * d
+	if d > 177.3 {
+		id += 0.11 * (d - 177.3)
+	}
+
+	ppl := math.Max(0, math.Min(s.Loss, 1)) * 100
+	ie := codec.Ie + (95-codec.Ie)*ppl/(ppl+codec.Bpl)
+
+	r := math.Max(0, math.Min(baseR-id-ie, 100))
+	return Score{R: r, MOS: mos(r)}
+}
+
+// mos maps an R factor to a mean opinion score (G.107 annex B)
+func mos(r float64) float64 {
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	return 1 + 0.035*r + r*(r-60)*(100-r)*7e-6
+}
+
+// Summary is the MOS spread over a whole call
+type Summary struct {
+	Min, Avg, Max float64
+	Samples       int
+}
+
+// Add includes one score in the summary
+func (s *Summary) Add(score Score) {
+	if s.Samples == 0 {
+		s.Min, s.Max = score.MOS, score.MOS
+	}
+	s.Min = math.Min(s.Min, score.MOS)
+	s.Max = math.Max(s.Max, score.MOS)
+	s.Avg += (score.MOS - s.Avg) / float64(s.Samples+1)
+	s.Samples++
+}
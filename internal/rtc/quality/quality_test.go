@@ -0,0 +1,44 @@
+package quality
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanLinkScoresHigh(t *testing.T) {
+	score := Estimate(CodecImpairment("audio/opus"), Sample{Delay: 20 * time.Millisecond, Jitter: 2 * time.Millisecond})
+	if score.MOS < 4.3 {
+		t.Errorf("expected MOS above 4.3 on a clean link, got %.2f (R %.1f)", score.MOS, score.R)
+	}
+}
+
+func TestLossAndDelayLowerScore(t *testing.T) {
+	codec := CodecImpairment("audio/PCMU")
+	clean := Estimate(codec, Sample{Delay: 20 * time.Millisecond})
+	lossy := Estimate(codec, Sample{Delay: 20 * time.Millisecond, Loss: 0.05})
+	slow := Estimate(codec, Sample{Delay: 400 * time.Millisecond})
+
+	if lossy.MOS >= clean.MOS || slow.MOS >= clean.MOS {
+		t.Fatalf("expected impairments to lower MOS: clean %.2f lossy %.2f slow %.2f", clean.MOS, lossy.MOS, slow.MOS)
+	}
+	if lossy.MOS > WarnMOS {
+		t.Errorf("5%% loss without PLC should be below the warning level, got %.2f", lossy.MOS)
+	}
+}
+
+func TestScoreBounds(t *testing.T) {
+	score := Estimate(CodecImpairment("audio/opus"), Sample{Delay: 5 * time.Second, Loss: 1})
+	if score.R != 0 || score.MOS != 1 {
+		t.Errorf("expected worst score, got R %.1f MOS %.2f", score.R, score.MOS)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var s Summary
+	for _, mos := range []float64{4, 2, 3} {
+		s.Add(Score{MOS: mos})
+	}
+	if s.Min != 2 || s.Max != 4 || s.Avg != 3 || s.Samples != 3 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+}
@@ -0,0 +1,145 @@
+package rtc
+
+import (
+	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/metrics"
+	"p2p-call/internal/rtc/quality"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	qualityInterval  = 5 * time.Second
+	qualityRecovered = quality.WarnMOS + 0.2 // hysteresis so a flapping score warns once
+)
+
+// qualityMonitor estimates the quality of received audio from connection stats and playback concealment
+type qualityMonitor struct {
+	mu        sync.Mutex
+	codec     quality.Impairment
+	current   quality.Score
+	valid     bool
+	summary   quality.Summary
+	warned    bool
+	onWarning func(quality.Score)
+
+	// counters of the previous interval
+	received, lost    int64
+	concealed, played uint64
+}
+
+func newQualityMonitor() *qualityMonitor {
+	return &qualityMonitor{codec: quality.CodecImpairment("")}
+}
+
+// run samples stats until the connection closes
+func (m *qualityMonitor) run(pc *webrtc.PeerConnection, player pipeline.PlaybackSink) {
+	ticker := time.NewTicker(qualityInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		sample, ok := m.sample(pc.GetStats(), player)
+		if !ok {
+			continue
+		}
+		m.update(quality.Estimate(m.codecImpairment(), sample))
+	}
+}
+
+// sample builds the network state of the last interval, ok is false before any audio was received
+func (m *qualityMonitor) sample(stats webrtc.StatsReport, player pipeline.PlaybackSink) (quality.Sample, bool) {
+	var s quality.Sample
+	var received, lost int64
+	inbound := false
+	for _, stat := range stats {
+		switch st := stat.(type) {
+		case webrtc.InboundRTPStreamStats:
+			inbound = true
+			received += int64(st.PacketsReceived)
+			lost += int64(st.PacketsLost)
+			s.Jitter = time.Duration(st.Jitter * float64(time.Second))
+		case webrtc.RemoteInboundRTPStreamStats:
+			s.Delay = time.Duration(st.RoundTripTime / 2 * float64(time.Second))
+		}
+	}
+	if !inbound {
+		return s, false
+	}
+	s.Delay += player.Buffered()
+
+	concealed, played := player.Concealment()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if expected := (received - m.received) + (lost - m.lost); expected > 0 {
+		s.Loss = float64(max(lost-m.lost, 0)) / float64(expected)
+	}
+	// samples filled with noise cover loss the network never saw: late packets, decoder gaps
+	if played > m.played {
+		s.Loss = max(s.Loss, float64(concealed-m.concealed)/float64(played-m.played))
+	}
+	m.received, m.lost = received, lost
+	m.concealed, m.played = concealed, played
+	return s, true
+}
+
+func (m *qualityMonitor) update(score quality.Score) {
+	m.mu.Lock()
+	m.current = score
+	m.valid = true
+	m.summary.Add(score)
+	warn := !m.warned && score.MOS < quality.WarnMOS
+	if warn {
+		m.warned = true
+	} else if score.MOS >= qualityRecovered {
+		m.warned = false
+	}
+	onWarning := m.onWarning
+	m.mu.Unlock()
+
+	metrics.SetQuality(score.R, score.MOS)
+	log.Debug().Float64("r", score.R).Float64("mos", score.MOS).Msg("Call quality")
+
+	if warn {
+		log.Warn().Float64("mos", score.MOS).Msg("Call quality dropped")
+		if onWarning != nil {
+			onWarning(score)
+		}
+	}
+}
+
+func (m *qualityMonitor) setCodec(mimeType string) {
+	m.mu.Lock()
+	m.codec = quality.CodecImpairment(mimeType)
+	m.mu.Unlock()
+}
+
+func (m *qualityMonitor) codecImpairment() quality.Impairment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.codec
+}
+
+func (m *qualityMonitor) score() (quality.Score, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, m.valid
+}
+
+func (m *qualityMonitor) callSummary() quality.Summary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.summary
+}
+
+func (m *qualityMonitor) setWarningHandler(handler func(quality.Score)) {
+	m.mu.Lock()
+	m.onWarning = handler
+	m.mu.Unlock()
+}
@@ -3,12 +3,23 @@ package rtc
 import (
 	"context"
 	"fmt"
+	"io"
+	"p2p-call/internal/audio/chain"
 	audiocfg "p2p-call/internal/audio/config"
+	"p2p-call/internal/audio/dsp"
 	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/metrics"
+	"p2p-call/internal/rtc/congestion"
+	"p2p-call/internal/rtc/latency"
+	"p2p-call/internal/rtc/quality"
+	"p2p-call/internal/rtc/track"
+	"p2p-call/internal/rtc/turncreds"
 	"p2p-call/pkg/config"
 	"p2p-call/pkg/system"
 	"time"
 
+	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog/log"
 )
@@ -16,23 +27,41 @@ import (
 type Connection struct {
 	Pipeline         *pipeline.AudioPipeline
 	ConStatusChannel chan error
+	audioTrack       *track.AudioTrack
+	dtmfCfg          config.DTMFConfig
+	quality          *qualityMonitor
+	latency          *latencyMonitor
+	listeners        []io.Closer // fixed port ICE muxes
+	signal           *Signal
+	hold             holdState
+	holdCfg          config.HoldConfig
 }
 
 func NewConnection(pipeline *pipeline.AudioPipeline) *Connection {
 	return &Connection{
 		Pipeline:         pipeline,
 		ConStatusChannel: make(chan error, 1),
+		dtmfCfg:          config.GetDTMFConfig(),
+		quality:          newQualityMonitor(),
+		latency:          newLatencyMonitor(),
+		holdCfg:          config.GetHoldConfig(),
 	}
 }
 
-func createConfig() webrtc.Configuration {
+func createConfig(iceCfg config.ICEConfig, turnServers []webrtc.ICEServer) webrtc.Configuration {
 	stunServers := config.GetStunServers()
-	turnServers := config.GetTurnServers()
 
 	config := webrtc.Configuration{
 		BundlePolicy:  webrtc.BundlePolicyMaxBundle,
 		RTCPMuxPolicy: webrtc.RTCPMuxPolicyRequire,
 	}
+	if iceCfg.RelayOnly {
+		// only relay candidates are gathered and signalled, the peer sees the TURN server address
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+		if !hasTurnServer(turnServers) {
+			log.Warn().Msg("Relay only ICE policy without TURN servers, the call can't connect")
+		}
+	}
 
 	// use stun and turn servers from config
 	config.ICEServers = append(stunServers, turnServers...)
@@ -41,8 +70,78 @@ func createConfig() webrtc.Configuration {
 	return config
 }
 
+// createMediaEngine registers the audio codec, redundant audio wrapping it if enabled, DTMF events,
+// comfort noise and the audio level header extension
+func createMediaEngine(audioCfg *audiocfg.AudioConfig, redCfg config.RedConfig) (*webrtc.MediaEngine, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    audioCfg.MimeType,
+			ClockRate:   audioCfg.SampleRate,
+			Channels:    audioCfg.Channels,
+			SDPFmtpLine: audioCfg.SDPFmtpLine,
+		},
+		PayloadType: webrtc.PayloadType(audioCfg.PayloadType),
+	}, webrtc.RTPCodecTypeAudio)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to register codec: %v", err)
+	}
+
+	if redCfg.Enabled {
+		err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    audiocfg.MimeTypeRED,
+				ClockRate:   audioCfg.SampleRate,
+				Channels:    audioCfg.Channels,
+				SDPFmtpLine: fmt.Sprintf("%d/%d", audioCfg.PayloadType, audioCfg.PayloadType),
+			},
+			PayloadType: audiocfg.PayloadTypeRED,
+		}, webrtc.RTPCodecTypeAudio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register red codec: %v", err)
+		}
+	}
+
+	// telephone events must share the clock rate of the audio codec
+	err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    track.MimeTypeTelephoneEvent,
+			ClockRate:   audioCfg.SampleRate,
+			Channels:    1,
+			SDPFmtpLine: "0-15",
+		},
+		PayloadType: audiocfg.PayloadTypeTelephoneEvent,
+	}, webrtc.RTPCodecTypeAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register telephone-event codec: %v", err)
+	}
+
+	// comfort noise is defined for 8 kHz codecs, opus carries its own
+	if audioCfg.DTX && audioCfg.SampleRate == audiocfg.SampleRatePCM {
+		err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  audiocfg.MimeTypeCN,
+				ClockRate: audioCfg.SampleRate,
+				Channels:  1,
+			},
+			PayloadType: audiocfg.PayloadTypeCN,
+		}, webrtc.RTPCodecTypeAudio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register comfort noise codec: %v", err)
+		}
+	}
+
+	// per packet level lets the remote side see activity without decoding
+	err = mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, webrtc.RTPCodecTypeAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register audio level extension: %v", err)
+	}
+	return mediaEngine, nil
+}
+
 // reads connection log and process errors
-func (con Connection) LogConnectionErrors(connErrors chan error) {
+func (con *Connection) LogConnectionErrors(connErrors chan error) {
 	for {
 		err := <-connErrors
 		if err != nil {
@@ -53,9 +152,17 @@ func (con Connection) LogConnectionErrors(connErrors chan error) {
 }
 
 // returns connection result error, nil if success
-func (con Connection) Connect(ctx context.Context, audioCfg *audiocfg.AudioConfig) error {
+func (con *Connection) Connect(ctx context.Context, audioCfg *audiocfg.AudioConfig) error {
+	startedAt := time.Now()
+
 	// create nat config
-	config := createConfig()
+	iceCfg := config.GetICEConfig()
+	turnProvider := turncreds.NewProvider(config.GetTurnConfig())
+	turnServers, turnExpires, err := turnProvider.ICEServers(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get TURN credentials, continuing without TURN")
+	}
+	rtcConfig := createConfig(iceCfg, turnServers)
 
 	settingEngine := webrtc.SettingEngine{}
 	settingEngine.SetICETimeouts(
@@ -64,43 +171,50 @@ func (con Connection) Connect(ctx context.Context, audioCfg *audiocfg.AudioConfi
 		time.Second*5,  // Keepalive interval
 	)
 
-	settingEngine.SetNetworkTypes([]webrtc.NetworkType{
-		webrtc.NetworkTypeTCP4,
-		webrtc.NetworkTypeTCP6,
-		webrtc.NetworkTypeUDP4,
-		webrtc.NetworkTypeUDP6,
-	})
-
-	mediaEngine := &webrtc.MediaEngine{}
-	err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
-		RTPCodecCapability: webrtc.RTPCodecCapability{
-			MimeType:    audioCfg.MimeType,
-			ClockRate:   audioCfg.SampleRate,
-			Channels:    audioCfg.Channels,
-			SDPFmtpLine: audioCfg.SDPFmtpLine,
-		},
-		PayloadType: webrtc.PayloadType(audioCfg.PayloadType),
-	}, webrtc.RTPCodecTypeAudio)
+	applyICEPolicy(&settingEngine, iceCfg)
+	listeners, err := applyPortConfig(&settingEngine, config.GetPortConfig())
+	if err != nil {
+		return err
+	}
+	con.listeners = listeners
 
+	redCfg := config.GetRedConfig()
+	mediaEngine, err := createMediaEngine(audioCfg, redCfg)
 	if err != nil {
-		return fmt.Errorf("failed to register codec: %v", err)
+		return err
+	}
+
+	// default interceptors generate the RTCP reports the bitrate controller reacts to
+	interceptorRegistry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
+		return fmt.Errorf("failed to register interceptors: %v", err)
 	}
 
 	api := webrtc.NewAPI(
 		webrtc.WithMediaEngine(mediaEngine),
 		webrtc.WithSettingEngine(settingEngine),
+		webrtc.WithInterceptorRegistry(interceptorRegistry),
 	)
 
-	peerConnection, err := api.NewPeerConnection(config)
+	peerConnection, err := api.NewPeerConnection(rtcConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create peer connection: %v", err)
 	}
 	//defer peerConnection.Close()
 
-	audioTrack, err := setupAudioTrack(peerConnection, audioCfg)
+	audioTrack, rtpSender, err := setupAudioTrack(peerConnection, audioCfg)
 	if err != nil {
 		return fmt.Errorf("failed to setup audio track: %v", err)
 	}
+	con.audioTrack = audioTrack
+
+	rtpSender.Transport().ICETransport().OnSelectedCandidatePairChange(func(pair *webrtc.ICECandidatePair) {
+		metrics.SetCandidatePair(connectionType(pair.Local.Typ), connectionType(pair.Remote.Typ))
+	})
+
+	controller := congestion.NewController(config.GetBitrateConfig(), audioCfg.Encoder, con.Pipeline.Capture, audioCfg.SampleRate).
+		WithRedundancy(con.Pipeline, redCfg)
+	go controller.Run(rtpSender)
 
 	sessionID := system.GenerateSessionID()
 	fmt.Printf("Session ID: %s\n", sessionID)
@@ -109,12 +223,108 @@ func (con Connection) Connect(ctx context.Context, audioCfg *audiocfg.AudioConfi
 	eventHandler := EventHandlers{
 		statusChannel: con.ConStatusChannel,
 		pipeline:      con.Pipeline,
+		latency:       con.latency,
+		startedAt:     startedAt,
 	}
 	eventHandler.setupEventHandlers(peerConnection)
+	con.quality.setCodec(audioCfg.MimeType)
+	go con.quality.run(peerConnection, con.Pipeline.Playback)
+	con.latency.setClockRate(audioCfg.SampleRate)
+	go con.latency.run(peerConnection, con.Pipeline)
 	go con.Pipeline.StartSending(audioTrack)
 	signal := NewSignal(sessionID, peerConnection)
+	signal.OnRemoteHold(con.handleRemoteHold)
+	con.signal = signal
 	if err := signal.StartWebrtcCon(ctx); err != nil {
 		return err
 	}
+	go refreshTurnCredentials(ctx, peerConnection, turnProvider, turnExpires, signal.RestartICE)
 	return nil
 }
+
+// Close releases the fixed port ICE listeners
+func (con *Connection) Close() {
+	closeAll(con.listeners)
+	con.listeners = nil
+}
+
+// SendDTMF sends digits (0-9, *, #, A-D) to the remote peer as telephone events,
+// blocks until all digits are sent
+func (con *Connection) SendDTMF(digits string) error {
+	if con.audioTrack == nil {
+		return fmt.Errorf("call is not connected")
+	}
+	return con.audioTrack.SendDTMF(digits, con.dtmfCfg.Duration, con.dtmfCfg.Gap)
+}
+
+// OnDTMF sets the handler called once for every digit the remote peer sends
+func (con *Connection) OnDTMF(handler func(digit rune)) {
+	con.Pipeline.SetDTMFHandler(handler)
+}
+
+// RemoteAudioLevel returns the remote level in dBov (-127 is silence) and whether the remote side is talking,
+// taken from the audio level header extension
+func (con *Connection) RemoteAudioLevel() (dBov int, speaking bool) {
+	level, speaking := con.Pipeline.RemoteLevel()
+	return -int(level), speaking
+}
+
+// Quality returns the latest estimate of received audio quality, ok is false until audio arrived
+func (con *Connection) Quality() (score quality.Score, ok bool) {
+	return con.quality.score()
+}
+
+// QualitySummary returns the MOS spread since the call started
+func (con *Connection) QualitySummary() quality.Summary {
+	return con.quality.callSummary()
+}
+
+// OnQualityWarning sets the handler called when the estimated MOS drops below quality.WarnMOS
+func (con *Connection) OnQualityWarning(handler func(score quality.Score)) {
+	con.quality.setWarningHandler(handler)
+}
+
+// Latency returns the latest mouth-to-ear delay estimate, ok is false until audio arrived
+func (con *Connection) Latency() (breakdown latency.Breakdown, ok bool) {
+	return con.latency.breakdown()
+}
+
+// EchoStats returns the echo canceller state, ok is false when echo cancellation is off
+func (con *Connection) EchoStats() (stats dsp.EchoStats, ok bool) {
+	return con.Pipeline.EchoStats()
+}
+
+// NoiseSuppression reports whether noise suppression is on, ok is false when it is not enabled
+func (con *Connection) NoiseSuppression() (on, ok bool) {
+	return con.Pipeline.NoiseSuppression()
+}
+
+// SetNoiseSuppression switches noise suppression on or off, ok is false when it is not enabled
+func (con *Connection) SetNoiseSuppression(on bool) (ok bool) {
+	return con.Pipeline.SetNoiseSuppression(on)
+}
+
+// ProcessingStages returns the audio processing stages of both directions in order
+func (con *Connection) ProcessingStages() (capture, playback []chain.StageStats) {
+	return con.Pipeline.Stages()
+}
+
+// SetStageBypass passes audio around the named processing stage, or through it again
+func (con *Connection) SetStageBypass(name string, bypassed bool) error {
+	return con.Pipeline.SetStageBypass(name, bypassed)
+}
+
+// InputGain returns the microphone gain and whether it is automatic, ok is false when gain control is off
+func (con *Connection) InputGain() (dB float64, automatic, ok bool) {
+	return con.Pipeline.InputGain()
+}
+
+// SetInputGain applies dB of fixed microphone gain instead of automatic gain control
+func (con *Connection) SetInputGain(dB float64) (ok bool) {
+	return con.Pipeline.SetInputGain(dB)
+}
+
+// SetAutomaticGain switches automatic gain control on or off
+func (con *Connection) SetAutomaticGain(automatic bool) (ok bool) {
+	return con.Pipeline.SetAutomaticGain(automatic)
+}
@@ -3,6 +3,7 @@ package rtc
 import (
 	"fmt"
 	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/metrics"
 	"time"
 
 	"github.com/pion/webrtc/v4"
@@ -12,27 +13,31 @@ import (
 type EventHandlers struct {
 	statusChannel chan error
 	pipeline      *pipeline.AudioPipeline
+	latency       *latencyMonitor
+	startedAt     time.Time // when the call was started, for time to connect
+}
+
+// connectionType names a candidate type by how the connection goes through
+func connectionType(typ webrtc.ICECandidateType) string {
+	switch typ.String() {
+	case "host":
+		return "Direct" // local network or public ip
+	case "srflx":
+		return "STUN" // via stun server
+	case "relay":
+		return "TURN" // via turn server (relay)
+	case "prflx":
+		return "Peer" // addition peer reflexive candidate
+	default:
+		return "Undefined"
+	}
 }
 
 // handleIceCandidate processes new ICE candidates
 func (h EventHandlers) handleIceCandidate(candidate *webrtc.ICECandidate) {
 	if candidate != nil {
-		var connType string
-		switch candidate.Typ.String() {
-		case "host":
-			connType = "Direct" // local network or public ip
-		case "srflx":
-			connType = "STUN" // via stun server
-		case "relay":
-			connType = "TURN" // via turn server (relay)
-		case "prflx":
-			connType = "Peer" // addition peer reflexive candidate
-		default:
-			connType = "Undefined"
-		}
-
 		log.Debug().
-			Str("type", connType).
+			Str("type", connectionType(candidate.Typ)).
 			Str("protocol", candidate.Protocol.String()).
 			Str("address", candidate.Address).
 			Uint16("port", candidate.Port).
@@ -65,6 +70,9 @@ func (h EventHandlers) handleConnectionStateChange(state webrtc.PeerConnectionSt
 	switch state {
 	case webrtc.PeerConnectionStateConnected:
 		log.Info().Msg("You can start messaging!")
+		if !h.startedAt.IsZero() {
+			metrics.SetTimeToConnect(time.Since(h.startedAt))
+		}
 		h.statusChannel <- nil // signal successful connection
 	case webrtc.PeerConnectionStateFailed:
 		h.statusChannel <- fmt.Errorf("peer connection failed")
@@ -78,7 +86,8 @@ func (h EventHandlers) handleTrackEvent(track *webrtc.TrackRemote, receiver *web
 
 	if track.Kind() == webrtc.RTPCodecTypeAudio {
 		log.Info().Msg("Audio track received from peer")
-		go h.pipeline.StartReceiving(track)
+		go h.pipeline.StartReceiving(track, receiver.GetParameters())
+		go h.latency.readReports(receiver)
 	}
 }
 
@@ -88,6 +97,7 @@ func (h EventHandlers) setupEventHandlers(pc *webrtc.PeerConnection) {
 	pc.OnICEConnectionStateChange(h.handleIceConnectionStateChange)
 	pc.OnConnectionStateChange(h.handleConnectionStateChange)
 	pc.OnTrack(h.handleTrackEvent)
+	metrics.RegisterConnection(pc)
 	// start logging stats
 	go logStat(pc)
 }
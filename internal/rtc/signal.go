@@ -56,7 +56,28 @@ func (s *Signal) StartWebrtcCon(ctx context.Context) error {
 	log.Info().Msg("Handshake completed")
 
 	// Negotiate WebRTC
-	return s.negotiate(ctx)
+	if err := s.negotiate(ctx); err != nil {
+		return err
+	}
+
+	// later offers change the call, e.g. hold and resume, the first offerer makes them all
+	go s.negotiator.Serve(ctx, s.hostID < s.peerID)
+	return nil
+}
+
+// SetHold tells the peer through renegotiation whether we hold the call
+func (s *Signal) SetHold(ctx context.Context, hold bool) error {
+	return s.negotiator.SetHold(ctx, hold)
+}
+
+// RestartICE renegotiates the call with an ICE restart
+func (s *Signal) RestartICE(ctx context.Context) error {
+	return s.negotiator.RestartICE(ctx)
+}
+
+// OnRemoteHold sets the handler called with the hold state of the peer's offers and answers
+func (s *Signal) OnRemoteHold(handler negotiator.HoldCallBack) {
+	s.negotiator.OnRemoteHold = handler
 }
 
 func (s *Signal) handleStream(stream network.Stream) {
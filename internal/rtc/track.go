@@ -3,13 +3,14 @@ package rtc
 import (
 	"fmt"
 	audiocfg "p2p-call/internal/audio/config"
+	"p2p-call/internal/rtc/track"
 
 	"github.com/pion/webrtc/v4"
 	"github.com/rs/zerolog/log"
 )
 
 // setupAudioTrack creates and adds an audio track to the peer connection
-func setupAudioTrack(pc *webrtc.PeerConnection, audioConfig *audiocfg.AudioConfig) (*webrtc.TrackLocalStaticSample, error) {
+func setupAudioTrack(pc *webrtc.PeerConnection, audioConfig *audiocfg.AudioConfig) (*track.AudioTrack, *webrtc.RTPSender, error) {
 	var codecCapability webrtc.RTPCodecCapability
 	codecCapability = webrtc.RTPCodecCapability{
 		MimeType:  audioConfig.MimeType,
@@ -17,18 +18,15 @@ func setupAudioTrack(pc *webrtc.PeerConnection, audioConfig *audiocfg.AudioConfi
 		ClockRate: audioConfig.SampleRate, // 8000 для PCMU
 	}
 
-	audioTrack, err := webrtc.NewTrackLocalStaticSample(
+	audioTrack := track.NewAudioTrack(
 		codecCapability,
 		"audio",
 		"microphone",
 	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create audio track: %w", err)
-	}
 
 	rtpSender, err := pc.AddTrack(audioTrack)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add track: %w", err)
+		return nil, nil, fmt.Errorf("failed to add track: %w", err)
 	}
 
 	log.Info().
@@ -37,5 +35,5 @@ func setupAudioTrack(pc *webrtc.PeerConnection, audioConfig *audiocfg.AudioConfi
 		Uint32("sample_rate", audioConfig.SampleRate).
 		Msg("Audio track added")
 
-	return audioTrack, nil
+	return audioTrack, rtpSender, nil
 }
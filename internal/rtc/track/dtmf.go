@@ -0,0 +1,183 @@
+package track
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// RFC 4733 telephone-event payload: event(8) | E(1) R(1) volume(6) | duration(16)
+
+const (
+	MimeTypeTelephoneEvent = "audio/telephone-event"
+
+	dtmfPacketInterval = 50 * time.Millisecond
+	dtmfEndRepeats     = 3  // end packets are repeated for loss resilience
+	dtmfVolume         = 10 // -10 dBm0
+	dtmfEventSize      = 4
+)
+
+var (
+	ErrInvalidDigit        = errors.New("invalid DTMF digit")
+	ErrNoDigits            = errors.New("no DTMF digits")
+	ErrDurationTooLong     = errors.New("DTMF duration doesn't fit the event duration field")
+	ErrEventsNotNegotiated = errors.New("telephone-event not negotiated")
+)
+
+const dtmfDigits = "0123456789*#ABCD"
+
+// Event is one decoded telephone-event payload
+type Event struct {
+	Digit    rune
+	End      bool
+	Volume   uint8
+	Duration uint16 // in clock units since the event timestamp
+}
+
+// DigitEvent maps a DTMF digit to its event code
+func DigitEvent(digit rune) (uint8, error) {
+	i := strings.IndexRune(dtmfDigits, digit)
+	if i < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDigit, digit)
+	}
+	return uint8(i), nil
+}
+
+// Marshal encodes the event as a telephone-event payload
+func (e Event) Marshal() ([]byte, error) {
+	code, err := DigitEvent(e.Digit)
+	if err != nil {
+		return nil, err
+	}
+	flags := e.Volume & 0x3f
+	if e.End {
+		flags |= 0x80
+	}
+	return []byte{code, flags, byte(e.Duration >> 8), byte(e.Duration)}, nil
+}
+
+// ParseEvent decodes a telephone-event payload, codes above D are not DTMF and rejected
+func ParseEvent(payload []byte) (Event, error) {
+	if len(payload) < dtmfEventSize {
+		return Event{}, fmt.Errorf("telephone-event payload too short: %d bytes", len(payload))
+	}
+	if int(payload[0]) >= len(dtmfDigits) {
+		return Event{}, fmt.Errorf("%w: event code %d", ErrInvalidDigit, payload[0])
+	}
+	return Event{
+		Digit:    rune(dtmfDigits[payload[0]]),
+		End:      payload[1]&0x80 != 0,
+		Volume:   payload[1] & 0x3f,
+		Duration: uint16(payload[2])<<8 | uint16(payload[3]),
+	}, nil
+}
+
+// SendDTMF sends digits one after another as telephone events.
+// Media packets are held back while an event plays, the RTP clock keeps running.
+// duration must fit the 16 bit duration field in clock units, about 1.36 s at 48 kHz.
+func (t *AudioTrack) SendDTMF(digits string, duration, gap time.Duration) error {
+	t.dtmfMu.Lock()
+	defer t.dtmfMu.Unlock()
+
+	if digits == "" {
+		return ErrNoDigits
+	}
+	if units := uint64(duration) * uint64(t.codec.ClockRate) / uint64(time.Second); units > 0xFFFF {
+		return fmt.Errorf("%w: %v", ErrDurationTooLong, duration)
+	}
+	for _, digit := range digits {
+		if _, err := DigitEvent(digit); err != nil {
+			return err
+		}
+	}
+
+	for i, digit := range digits {
+		if i > 0 {
+			time.Sleep(gap)
+		}
+		if err := t.sendEvent(digit, duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendEvent sends one digit: an update every 50 ms with growing duration, then repeated end packets
+func (t *AudioTrack) sendEvent(digit rune, duration time.Duration) error {
+	t.mu.Lock()
+	if _, ok := t.payloadTypeLocked(MimeTypeTelephoneEvent); !ok {
+		t.mu.Unlock()
+		return ErrEventsNotNegotiated
+	}
+	start := t.timestamp
+	t.eventActive = true
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.eventActive = false
+		// make sure the next event can't reuse this timestamp when no media advanced the clock
+		if elapsed := t.timestamp - start; elapsed < t.clockUnits(duration) {
+			t.timestamp = start + t.clockUnits(duration)
+		}
+		t.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(dtmfPacketInterval)
+	defer ticker.Stop()
+
+	marker := true
+	for sent := dtmfPacketInterval; ; sent += dtmfPacketInterval {
+		end := sent >= duration
+		event := Event{Digit: digit, Volume: dtmfVolume, Duration: uint16(t.clockUnits(min(sent, duration)))}
+
+		repeats := 1
+		if end {
+			event.End = true
+			repeats = dtmfEndRepeats
+		}
+		for range repeats {
+			if err := t.writeEvent(event, start, marker); err != nil {
+				return err
+			}
+			marker = false
+		}
+		if end {
+			return nil
+		}
+		<-ticker.C
+	}
+}
+
+func (t *AudioTrack) writeEvent(event Event, timestamp uint32, marker bool) error {
+	payload, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pt, ok := t.payloadTypeLocked(MimeTypeTelephoneEvent)
+	if !ok {
+		return ErrEventsNotNegotiated
+	}
+	if t.held {
+		return nil
+	}
+	header := &rtp.Header{
+		Version:        2,
+		Marker:         marker,
+		PayloadType:    pt,
+		SequenceNumber: t.sequence,
+		Timestamp:      timestamp,
+		SSRC:           uint32(t.binding.ssrc),
+	}
+	t.sequence++
+
+	_, err = t.binding.writeStream.WriteRTP(header, payload)
+	return err
+}
@@ -0,0 +1,66 @@
+package track
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestEventRoundTrip(t *testing.T) {
+	for _, digit := range dtmfDigits {
+		event := Event{Digit: digit, End: digit == '#', Volume: 10, Duration: 4800}
+		payload, err := event.Marshal()
+		if err != nil {
+			t.Fatalf("marshal %q: %v", digit, err)
+		}
+		parsed, err := ParseEvent(payload)
+		if err != nil {
+			t.Fatalf("parse %q: %v", digit, err)
+		}
+		if parsed != event {
+			t.Errorf("round trip %q: got %+v, want %+v", digit, parsed, event)
+		}
+	}
+}
+
+func TestEventWireFormat(t *testing.T) {
+	payload, err := Event{Digit: '5', End: true, Volume: 10, Duration: 800}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{5, 0x80 | 10, 0x03, 0x20}
+	for i := range want {
+		if payload[i] != want[i] {
+			t.Fatalf("payload %v, want %v", payload, want)
+		}
+	}
+}
+
+func TestInvalidDigit(t *testing.T) {
+	if _, err := DigitEvent('x'); err == nil {
+		t.Error("expected error for invalid digit")
+	}
+	if _, err := ParseEvent([]byte{16, 0, 0, 0}); err == nil {
+		t.Error("expected error for non DTMF event code")
+	}
+}
+
+func TestSendDTMFRejects(t *testing.T) {
+	track := NewAudioTrack(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, "audio", "test")
+	for _, tc := range []struct {
+		digits   string
+		duration time.Duration
+		want     error
+	}{
+		{"", 100 * time.Millisecond, ErrNoDigits},
+		{"1", 1400 * time.Millisecond, ErrDurationTooLong}, // 67200 units at 48 kHz
+		{"1x", 100 * time.Millisecond, ErrInvalidDigit},
+		{"1", 1365 * time.Millisecond, ErrEventsNotNegotiated},
+	} {
+		if err := track.SendDTMF(tc.digits, tc.duration, 0); !errors.Is(err, tc.want) {
+			t.Errorf("SendDTMF(%q, %v) = %v, want %v", tc.digits, tc.duration, err, tc.want)
+		}
+	}
+}
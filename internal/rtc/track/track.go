@@ -0,0 +1,197 @@
+package track
+
+import (
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// Sample is one payload sent as a single RTP packet
+type Sample struct {
+	MimeType string        // negotiated codec to send with, empty for the track codec
+	Data     []byte        // payload
+	Duration time.Duration // how far the RTP clock advances after this packet
+	Marker   bool          // first packet of a talkspurt after suppressed silence
+
+	AudioLevel *rtp.AudioLevelExtension // RFC 6464 level, sent only if the extension was negotiated
+}
+
+type binding struct {
+	id           string
+	ssrc         webrtc.SSRC
+	payloadTypes map[string]webrtc.PayloadType // lower case mime type -> negotiated payload type
+	audioLevelID uint8                         // 0 when the audio level extension wasn't negotiated
+	writeStream  webrtc.TrackLocalWriter
+}
+
+// AudioTrack is a TrackLocal that owns the RTP clock of the outgoing stream and can send
+// packets with any negotiated payload type on the same SSRC (primary codec, RED, events).
+// webrtc.TrackLocalStaticSample always rewrites the payload type to the primary codec.
+type AudioTrack struct {
+	mu        sync.Mutex
+	codec     webrtc.RTPCodecCapability
+	id        string
+	streamID  string
+	binding   *binding
+	sequence  uint16
+	timestamp uint32
+	held      bool // nothing is sent while the negotiated direction doesn't include sending
+
+	dtmfMu      sync.Mutex // serialises digit sequences
+	eventActive bool       // media is held back while a telephone event plays
+}
+
+func NewAudioTrack(codec webrtc.RTPCodecCapability, id, streamID string) *AudioTrack {
+	return &AudioTrack{
+		codec:     codec,
+		id:        id,
+		streamID:  streamID,
+		sequence:  uint16(rand.Uint32()),
+		timestamp: rand.Uint32(),
+	}
+}
+
+// Bind is called by the PeerConnection after negotiation, selects the primary codec
+// and remembers payload types of all other negotiated codecs
+func (t *AudioTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var primary *webrtc.RTPCodecParameters
+	payloadTypes := make(map[string]webrtc.PayloadType)
+	for _, codec := range ctx.CodecParameters() {
+		if codec.ClockRate != t.codec.ClockRate {
+			continue
+		}
+		mime := strings.ToLower(codec.MimeType)
+		if _, ok := payloadTypes[mime]; !ok {
+			payloadTypes[mime] = codec.PayloadType
+		}
+		if primary == nil && strings.EqualFold(codec.MimeType, t.codec.MimeType) {
+			primary = &codec
+		}
+	}
+	if primary == nil {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+
+	t.binding = &binding{
+		id:           ctx.ID(),
+		ssrc:         ctx.SSRC(),
+		payloadTypes: payloadTypes,
+		audioLevelID: HeaderExtensionID(ctx.HeaderExtensions(), sdp.AudioLevelURI),
+		writeStream:  ctx.WriteStream(),
+	}
+	return *primary, nil
+}
+
+// Unbind is called when the track is removed from the PeerConnection
+func (t *AudioTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.binding == nil || t.binding.id != ctx.ID() {
+		return webrtc.ErrUnbindFailed
+	}
+	t.binding = nil
+	return nil
+}
+
+func (t *AudioTrack) ID() string { return t.id }
+
+func (t *AudioTrack) RID() string { return "" }
+
+func (t *AudioTrack) StreamID() string { return t.streamID }
+
+func (t *AudioTrack) Kind() webrtc.RTPCodecType { return webrtc.RTPCodecTypeAudio }
+
+func (t *AudioTrack) Codec() webrtc.RTPCodecCapability { return t.codec }
+
+// PayloadType returns the payload type negotiated for mimeType, ok is false if the remote
+// side did not accept the codec or negotiation has not finished yet
+func (t *AudioTrack) PayloadType(mimeType string) (uint8, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.payloadTypeLocked(mimeType)
+}
+
+func (t *AudioTrack) payloadTypeLocked(mimeType string) (uint8, bool) {
+	if t.binding == nil {
+		return 0, false
+	}
+	if mimeType == "" {
+		mimeType = t.codec.MimeType
+	}
+	pt, ok := t.binding.payloadTypes[strings.ToLower(mimeType)]
+	return uint8(pt), ok
+}
+
+// WriteSample sends the sample as one RTP packet and advances the RTP clock.
+// Samples written before negotiation completes, while held and empty samples only advance the clock,
+// like TrackLocalStaticSample does.
+func (t *AudioTrack) WriteSample(sample Sample) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	defer t.advanceLocked(sample.Duration)
+
+	pt, ok := t.payloadTypeLocked(sample.MimeType)
+	if !ok || len(sample.Data) == 0 || t.eventActive || t.held {
+		return nil
+	}
+
+	header := &rtp.Header{
+		Version:        2,
+		Marker:         sample.Marker,
+		PayloadType:    pt,
+		SequenceNumber: t.sequence,
+		Timestamp:      t.timestamp,
+		SSRC:           uint32(t.binding.ssrc),
+	}
+	t.sequence++
+
+	if sample.AudioLevel != nil && t.binding.audioLevelID != 0 {
+		level, err := sample.AudioLevel.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := header.SetExtension(t.binding.audioLevelID, level); err != nil {
+			return err
+		}
+	}
+
+	_, err := t.binding.writeStream.WriteRTP(header, sample.Data)
+	return err
+}
+
+// SetHeld stops or resumes sending while the call is on hold. The track stays on the sender
+// so its SSRC stays in the SDP and the peer's receiver picks the stream up again on resume.
+func (t *AudioTrack) SetHeld(held bool) {
+	t.mu.Lock()
+	t.held = held
+	t.mu.Unlock()
+}
+
+// HeaderExtensionID returns the negotiated id of the extension uri, 0 if it wasn't negotiated
+func HeaderExtensionID(extensions []webrtc.RTPHeaderExtensionParameter, uri string) uint8 {
+	for _, ext := range extensions {
+		if ext.URI == uri {
+			return uint8(ext.ID)
+		}
+	}
+	return 0
+}
+
+func (t *AudioTrack) advanceLocked(d time.Duration) {
+	t.timestamp += t.clockUnits(d)
+}
+
+// clockUnits converts a duration to RTP clock units
+func (t *AudioTrack) clockUnits(d time.Duration) uint32 {
+	return uint32(d * time.Duration(t.codec.ClockRate) / time.Second)
+}
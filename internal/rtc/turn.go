@@ -0,0 +1,75 @@
+package rtc
+
+import (
+	"context"
+	"p2p-call/internal/rtc/turncreds"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/webrtc/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	turnRefreshShare = 0.8 // renew after this part of the credential lifetime
+	turnRetryDelay   = time.Minute
+	turnRestartWait  = 45 * time.Second // longer than the negotiator waits for an answer
+)
+
+// refreshTurnCredentials renews time limited TURN credentials before they expire for as long as the call lasts
+// and restarts ICE through renegotiation, relays allocated with the old credentials would stop working.
+func refreshTurnCredentials(ctx context.Context, pc *webrtc.PeerConnection, provider *turncreds.Provider, expires time.Time,
+	restart func(context.Context) error) {
+	for !expires.IsZero() {
+		wait := time.Duration(float64(time.Until(expires)) * turnRefreshShare)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(max(wait, 0)):
+		}
+		if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+
+		servers, next, err := provider.ICEServers(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to renew TURN credentials")
+			expires = time.Now().Add(turnRetryDelay) // retry well before the old ones run out
+			continue
+		}
+
+		rtcConfig := pc.GetConfiguration()
+		rtcConfig.ICEServers = append(stunServers(rtcConfig.ICEServers), servers...)
+		expires = next
+		if err := pc.SetConfiguration(rtcConfig); err != nil {
+			log.Warn().Err(err).Msg("Failed to apply renewed TURN credentials")
+			continue
+		}
+		log.Debug().Time("expires", next).Msg("TURN credentials renewed")
+
+		restartCtx, cancel := context.WithTimeout(ctx, turnRestartWait)
+		if err := restart(restartCtx); err != nil {
+			log.Warn().Err(err).Msg("Failed to restart ICE with renewed TURN credentials")
+		}
+		cancel()
+	}
+}
+
+// stunServers keeps the stun: and stuns: URLs of the configuration, the turn: and turns: ones are renewed
+func stunServers(servers []webrtc.ICEServer) []webrtc.ICEServer {
+	var kept []webrtc.ICEServer
+	for _, server := range servers {
+		var urls []string
+		for _, rawURL := range server.URLs {
+			uri, err := stun.ParseURI(rawURL)
+			if err == nil && (uri.Scheme == stun.SchemeTypeSTUN || uri.Scheme == stun.SchemeTypeSTUNS) {
+				urls = append(urls, rawURL)
+			}
+		}
+		if len(urls) > 0 {
+			server.URLs = urls
+			kept = append(kept, server)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,65 @@
+package rtc
+
+import (
+	"context"
+	"p2p-call/internal/rtc/turncreds"
+	"p2p-call/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestRenewedTurnCredentialsRestartICE(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider := turncreds.NewProvider(config.TurnConfig{
+		Servers:  []config.TurnServer{{URL: "turn:127.0.0.1:3478"}},
+		Username: "alice",
+		Secret:   "s3cret",
+		TTL:      time.Hour,
+	})
+	servers, _, err := provider.ICEServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stun := webrtc.ICEServer{URLs: []string{"stun:127.0.0.1:3478"}}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: append([]webrtc.ICEServer{stun}, servers...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	restarted := make(chan []webrtc.ICEServer, 1)
+	restart := func(context.Context) error {
+		restarted <- pc.GetConfiguration().ICEServers
+		cancel() // one renewal is enough
+		return nil
+	}
+	// expiring now renews at once
+	go refreshTurnCredentials(ctx, pc, provider, time.Now(), restart)
+
+	select {
+	case applied := <-restarted:
+		if len(applied) != 2 || applied[0].URLs[0] != stun.URLs[0] || applied[1].Username == "" {
+			t.Errorf("ICE restarted with servers %+v, want the STUN server and renewed TURN credentials", applied)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ICE was not restarted after the credentials were renewed")
+	}
+}
+
+func TestStunServersKeepsSTUNURLs(t *testing.T) {
+	servers := []webrtc.ICEServer{
+		{URLs: []string{"stun:stun.example.com:3478"}},
+		{URLs: []string{"turn:turn.example.com:3478"}}, // TURN without credentials is still TURN
+		{URLs: []string{"stun:mixed.example.com", "turns:mixed.example.com"}, Username: "alice", Credential: "s3cret"},
+		{URLs: []string{"not a url"}},
+	}
+	kept := stunServers(servers)
+	if len(kept) != 2 || len(kept[0].URLs) != 1 || kept[0].URLs[0] != "stun:stun.example.com:3478" ||
+		len(kept[1].URLs) != 1 || kept[1].URLs[0] != "stun:mixed.example.com" {
+		t.Errorf("stunServers kept %+v, want only the stun: URLs", kept)
+	}
+}
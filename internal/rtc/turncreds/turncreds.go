@@ -0,0 +1,143 @@
+package turncreds
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"p2p-call/pkg/config"
+	"strconv"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Time limited TURN credentials as described in draft-uberti-behave-turn-rest:
+// username is "expiry:user", password is base64(HMAC-SHA1(secret, username)).
+
+const fetchTimeout = 10 * time.Second
+
+var ErrNoCredentials = errors.New("credentials response has no username or password")
+
+// Credentials is a username/password pair valid until Expires, zero Expires never expires
+type Credentials struct {
+	Username string
+	Password string
+	Expires  time.Time
+}
+
+// Compute derives credentials from the secret shared with the TURN server
+func Compute(secret, user string, ttl time.Duration, now time.Time) Credentials {
+	expires := now.Add(ttl)
+	username := strconv.FormatInt(expires.Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return Credentials{
+		Username: username,
+		Password: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		Expires:  expires,
+	}
+}
+
+// response of a credentials endpoint
+type response struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	TTL      int64    `json:"ttl"` // seconds
+	URIs     []string `json:"uris"`
+}
+
+// Fetch requests credentials from an HTTP endpoint, uris are the TURN urls it suggests, may be empty
+func Fetch(ctx context.Context, endpoint, user string) (creds Credentials, uris []string, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Credentials{}, nil, fmt.Errorf("invalid credentials url: %w", err)
+	}
+	query := u.Query()
+	if query.Get("service") == "" {
+		query.Set("service", "turn")
+	}
+	if user != "" && query.Get("username") == "" {
+		query.Set("username", user)
+	}
+	u.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Credentials{}, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Credentials{}, nil, fmt.Errorf("failed to fetch TURN credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, nil, fmt.Errorf("failed to fetch TURN credentials: %s", resp.Status)
+	}
+
+	var body response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Credentials{}, nil, fmt.Errorf("invalid TURN credentials response: %w", err)
+	}
+	if body.Username == "" || body.Password == "" {
+		return Credentials{}, nil, ErrNoCredentials
+	}
+	creds = Credentials{Username: body.Username, Password: body.Password}
+	if body.TTL > 0 {
+		creds.Expires = time.Now().Add(time.Duration(body.TTL) * time.Second)
+	}
+	return creds, body.URIs, nil
+}
+
+// Provider hands out TURN servers with fresh credentials from the configured source
+type Provider struct {
+	cfg config.TurnConfig
+}
+
+func NewProvider(cfg config.TurnConfig) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+// ICEServers returns TURN servers with credentials and when the earliest of them expires,
+// zero when none expire. Servers with their own static credentials keep them.
+func (p *Provider) ICEServers(ctx context.Context) ([]webrtc.ICEServer, time.Time, error) {
+	shared := Credentials{Username: p.cfg.Username, Password: p.cfg.Credential}
+	urls := make([]string, 0, len(p.cfg.Servers))
+	for _, server := range p.cfg.Servers {
+		urls = append(urls, server.URL)
+	}
+
+	switch {
+	case p.cfg.CredentialsURL != "":
+		creds, uris, err := Fetch(ctx, p.cfg.CredentialsURL, p.cfg.Username)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		shared = creds
+		if len(p.cfg.Servers) == 0 {
+			urls = uris
+		}
+	case p.cfg.Secret != "":
+		shared = Compute(p.cfg.Secret, p.cfg.Username, p.cfg.TTL, time.Now())
+	}
+
+	servers := make([]webrtc.ICEServer, 0, len(urls))
+	for i, u := range urls {
+		server := webrtc.ICEServer{URLs: []string{u}, Username: shared.Username, Credential: shared.Password}
+		if i < len(p.cfg.Servers) && p.cfg.Servers[i].Username != "" {
+			server.Username, server.Credential = p.cfg.Servers[i].Username, p.cfg.Servers[i].Credential
+		}
+		servers = append(servers, server)
+	}
+	return servers, shared.Expires, nil
+}
@@ -0,0 +1,82 @@
+package turncreds
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"p2p-call/pkg/config"
+	"testing"
+	"time"
+)
+
+func TestComputeMatchesRESTScheme(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	creds := Compute("s3cret", "alice", time.Hour, now)
+
+	if creds.Username != "1700003600:alice" {
+		t.Fatalf("unexpected username %q", creds.Username)
+	}
+	mac := hmac.New(sha1.New, []byte("s3cret"))
+	mac.Write([]byte(creds.Username))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); creds.Password != want {
+		t.Errorf("unexpected password %q, want %q", creds.Password, want)
+	}
+	if !creds.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected expiry %v", creds.Expires)
+	}
+}
+
+func TestFetchUsesEndpointServers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "turn" || r.URL.Query().Get("username") != "bob" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(response{
+			Username: "1700000000:bob",
+			Password: "pass",
+			TTL:      600,
+			URIs:     []string{"turns:turn.example.com:5349?transport=tcp"},
+		})
+	}))
+	defer srv.Close()
+
+	p := NewProvider(config.TurnConfig{Username: "bob", CredentialsURL: srv.URL})
+	servers, expires, err := p.ICEServers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].URLs[0] != "turns:turn.example.com:5349?transport=tcp" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+	if servers[0].Username != "1700000000:bob" || servers[0].Credential != "pass" {
+		t.Errorf("unexpected credentials %+v", servers[0])
+	}
+	if until := time.Until(expires); until < 590*time.Second || until > 600*time.Second {
+		t.Errorf("unexpected expiry in %v", until)
+	}
+}
+
+func TestPerServerCredentialsWin(t *testing.T) {
+	p := NewProvider(config.TurnConfig{
+		Secret: "s3cret",
+		TTL:    time.Hour,
+		Servers: []config.TurnServer{
+			{URL: "turn:a.example.com:3478"},
+			{URL: "turn:b.example.com:3478", Username: "static", Credential: "pw"},
+		},
+	})
+	servers, _, err := p.ICEServers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if servers[0].Username == "static" || servers[0].Credential == "" {
+		t.Errorf("expected computed credentials for first server, got %+v", servers[0])
+	}
+	if servers[1].Username != "static" || servers[1].Credential != "pw" {
+		t.Errorf("expected static credentials for second server, got %+v", servers[1])
+	}
+}
@@ -0,0 +1,139 @@
+package turnserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"p2p-call/pkg/config"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoPublicIP = errors.New("public IP of the relay is required")
+	ErrNoAuth     = errors.New("no TURN users or shared secret configured")
+)
+
+// Server is a STUN/TURN server other peers can use as their relay
+type Server struct {
+	server *turn.Server
+	addr   net.Addr // UDP address served on
+}
+
+// Start listens on the configured address and serves STUN binding and TURN allocations
+func Start(cfg config.TurnServerConfig) (*Server, error) {
+	publicIP := net.ParseIP(cfg.PublicIP)
+	if publicIP == nil {
+		return nil, ErrNoPublicIP
+	}
+	if len(cfg.Users) == 0 && cfg.Secret == "" {
+		return nil, ErrNoAuth
+	}
+
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	relayGenerator := func() turn.RelayAddressGenerator {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: publicIP,
+			Address:      "0.0.0.0",
+			MinPort:      uint16(cfg.PortMin),
+			MaxPort:      uint16(cfg.PortMax),
+		}
+	}
+
+	udpConn, err := net.ListenPacket("udp4", cfg.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP %s: %w", cfg.ListenAddr, err)
+	}
+	serverCfg := turn.ServerConfig{
+		Realm:         cfg.Realm,
+		AuthHandler:   authHandler(cfg, loggerFactory.NewLogger("turn")),
+		EventHandler:  eventHandler(),
+		LoggerFactory: loggerFactory,
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            udpConn,
+			RelayAddressGenerator: relayGenerator(),
+		}},
+	}
+
+	if cfg.TCP {
+		listener, err := net.Listen("tcp4", cfg.ListenAddr)
+		if err != nil {
+			udpConn.Close()
+			return nil, fmt.Errorf("failed to listen on TCP %s: %w", cfg.ListenAddr, err)
+		}
+		serverCfg.ListenerConfigs = []turn.ListenerConfig{{
+			Listener:              listener,
+			RelayAddressGenerator: relayGenerator(),
+		}}
+	}
+
+	server, err := turn.NewServer(serverCfg)
+	if err != nil {
+		udpConn.Close()
+		for _, l := range serverCfg.ListenerConfigs {
+			l.Listener.Close()
+		}
+		return nil, fmt.Errorf("failed to start TURN server: %w", err)
+	}
+
+	log.Info().
+		Str("listen", cfg.ListenAddr).
+		Str("public_ip", cfg.PublicIP).
+		Str("realm", cfg.Realm).
+		Int("port_min", cfg.PortMin).
+		Int("port_max", cfg.PortMax).
+		Bool("tcp", cfg.TCP).
+		Msg("TURN server started")
+	return &Server{server: server, addr: udpConn.LocalAddr()}, nil
+}
+
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// authHandler accepts static users first, then time limited credentials derived from the shared secret
+func authHandler(cfg config.TurnServerConfig, logger logging.LeveledLogger) turn.AuthHandler {
+	var rest turn.AuthHandler
+	if cfg.Secret != "" {
+		rest = turn.LongTermTURNRESTAuthHandler(cfg.Secret, logger)
+	}
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		if password, ok := cfg.Users[username]; ok {
+			return turn.GenerateAuthKey(username, realm, password), true
+		}
+		if rest != nil {
+			return rest(username, realm, srcAddr)
+		}
+		return nil, false
+	}
+}
+
+// eventHandler logs the allocation lifecycle
+func eventHandler() turn.EventHandler {
+	return turn.EventHandler{
+		OnAuth: func(srcAddr, _ net.Addr, protocol, username, _ string, method string, verdict bool) {
+			if !verdict {
+				log.Warn().Str("client", srcAddr.String()).Str("user", username).Str("method", method).Msg("TURN authentication failed")
+			}
+		},
+		OnAllocationCreated: func(srcAddr, _ net.Addr, protocol, username, _ string, relayAddr net.Addr, _ int) {
+			log.Info().
+				Str("client", srcAddr.String()).
+				Str("protocol", protocol).
+				Str("user", username).
+				Str("relay", relayAddr.String()).
+				Msg("TURN allocation created")
+		},
+		OnAllocationDeleted: func(srcAddr, _ net.Addr, protocol, username, _ string) {
+			log.Info().Str("client", srcAddr.String()).Str("protocol", protocol).Str("user", username).Msg("TURN allocation deleted")
+		},
+		OnAllocationError: func(srcAddr, _ net.Addr, protocol, message string) {
+			log.Warn().Str("client", srcAddr.String()).Str("protocol", protocol).Str("error", message).Msg("TURN allocation error")
+		},
+		OnPermissionCreated: func(srcAddr, _ net.Addr, _, username, _ string, relayAddr net.Addr, peer net.IP) {
+			log.Debug().Str("client", srcAddr.String()).Str("user", username).Str("peer", peer.String()).Msg("TURN permission created")
+		},
+	}
+}
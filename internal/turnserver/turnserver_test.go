@@ -0,0 +1,76 @@
+package turnserver
+
+import (
+	"net"
+	"p2p-call/internal/rtc/turncreds"
+	"p2p-call/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+func allocate(t *testing.T, server net.Addr, creds turncreds.Credentials) (net.Addr, error) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: server.String(),
+		TURNServerAddr: server.String(),
+		Conn:           conn,
+		Username:       creds.Username,
+		Password:       creds.Password,
+		Realm:          "p2p-call",
+		RTO:            100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	relay, err := client.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	defer relay.Close()
+	return relay.LocalAddr(), nil
+}
+
+func TestRESTCredentials(t *testing.T) {
+	const secret = "s3cret"
+	server, err := Start(config.TurnServerConfig{
+		ListenAddr: "127.0.0.1:0",
+		PublicIP:   "127.0.0.1",
+		Realm:      "p2p-call",
+		Users:      map[string]string{},
+		Secret:     secret,
+		PortMin:    50000,
+		PortMax:    50100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	now := time.Now()
+	relay, err := allocate(t, server.addr, turncreds.Compute(secret, "alice", time.Hour, now))
+	if err != nil {
+		t.Fatalf("allocation with valid credentials failed: %v", err)
+	}
+	if udp, ok := relay.(*net.UDPAddr); !ok || !udp.IP.Equal(net.IPv4(127, 0, 0, 1)) || udp.Port < 50000 || udp.Port > 50100 {
+		t.Errorf("relay address %v, want 127.0.0.1 in the port range", relay)
+	}
+
+	if _, err := allocate(t, server.addr, turncreds.Compute(secret, "alice", -time.Minute, now)); err == nil {
+		t.Error("allocation with expired credentials accepted")
+	}
+	if _, err := allocate(t, server.addr, turncreds.Compute("wrong", "alice", time.Hour, now)); err == nil {
+		t.Error("allocation with credentials of another secret accepted")
+	}
+}
@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// AECConfig controls the acoustic echo canceller on the microphone signal
+type AECConfig struct {
+	Enabled  bool
+	Tail     time.Duration // how long the room keeps echoing after the delay
+	MaxDelay time.Duration // longest speaker to microphone delay searched for
+}
+
+func GetAECConfig() AECConfig {
+	return AECConfig{
+		Enabled:  getEnvBool("AEC_ENABLED", true),
+		Tail:     getEnvMillis("AEC_TAIL", 64*time.Millisecond),
+		MaxDelay: getEnvMillis("AEC_MAX_DELAY", 400*time.Millisecond),
+	}
+}
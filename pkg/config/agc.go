@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+// AGCConfig controls the gain applied to the microphone signal and to received audio
+type AGCConfig struct {
+	Enabled    bool          // level speech automatically, otherwise InputGain applies
+	Target     int           // dBFS speech is levelled to
+	MaxGain    int           // dB quiet speech may be raised by
+	Attack     time.Duration // how fast the gain drops when speech gets louder
+	Release    time.Duration // how fast the gain rises when speech gets quieter
+	InputGain  int           // dB of fixed gain when AGC is off
+	OutputGain int           // dB applied to received audio
+}
+
+func GetAGCConfig() AGCConfig {
+	return AGCConfig{
+		Enabled:    getEnvBool("AGC_ENABLED", true),
+		Target:     getEnvInt("AGC_TARGET", -18),
+		MaxGain:    getEnvInt("AGC_MAX_GAIN", 30),
+		Attack:     getEnvMillis("AGC_ATTACK", 20*time.Millisecond),
+		Release:    getEnvMillis("AGC_RELEASE", 500*time.Millisecond),
+		InputGain:  getEnvInt("INPUT_GAIN", 0),
+		OutputGain: getEnvInt("OUTPUT_GAIN", 0),
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// audio backends selectable with AUDIO_INPUT and AUDIO_OUTPUT
+const (
+	AudioBackendDevice = "device" // sound card
+	AudioBackendFile   = "file"
+	AudioBackendNull   = "null" // silence in, audio discarded out
+)
+
+// AudioBackendConfig selects where captured audio comes from and where received audio goes
+type AudioBackendConfig struct {
+	Input          string
+	InputDevice    string // sound card by id or part of its name, empty for the default
+	InputFallback  string // sound card tried before the default when the selected one is unplugged
+	InputFile      string
+	InputLoop      bool // start the input file again when it ends
+	Output         string
+	OutputDevice   string
+	OutputFallback string
+	OutputFile     string
+}
+
+func GetAudioBackendConfig() AudioBackendConfig {
+	return AudioBackendConfig{
+		Input:          getEnvBackend("AUDIO_INPUT"),
+		InputDevice:    strings.TrimSpace(os.Getenv("AUDIO_INPUT_DEVICE")),
+		InputFallback:  strings.TrimSpace(os.Getenv("AUDIO_INPUT_FALLBACK")),
+		InputFile:      strings.TrimSpace(os.Getenv("AUDIO_INPUT_FILE")),
+		InputLoop:      getEnvBool("AUDIO_INPUT_LOOP", false),
+		Output:         getEnvBackend("AUDIO_OUTPUT"),
+		OutputDevice:   strings.TrimSpace(os.Getenv("AUDIO_OUTPUT_DEVICE")),
+		OutputFallback: strings.TrimSpace(os.Getenv("AUDIO_OUTPUT_FALLBACK")),
+		OutputFile:     strings.TrimSpace(os.Getenv("AUDIO_OUTPUT_FILE")),
+	}
+}
+
+// getEnvBackend reads an audio backend name, falls back to the sound card when unset or invalid
+func getEnvBackend(key string) string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	switch value {
+	case AudioBackendDevice, AudioBackendFile, AudioBackendNull:
+		return value
+	case "":
+	default:
+		log.Printf("Warning: invalid %s=%q, using %s", key, value, AudioBackendDevice)
+	}
+	return AudioBackendDevice
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// BitrateConfig limits the adaptive bitrate controller
+type BitrateConfig struct {
+	Enabled          bool
+	Min              int           // bitrate floor, bits per second
+	Max              int           // bitrate ceiling, bits per second
+	Start            int           // bitrate used before the first receiver report
+	MaxFrameDuration time.Duration // longest frame the controller may switch to under congestion
+}
+
+func GetBitrateConfig() BitrateConfig {
+	cfg := BitrateConfig{
+		Enabled:          getEnvBool("ADAPTIVE_BITRATE", true),
+		Min:              getEnvInt("BITRATE_MIN", 12000),
+		Max:              getEnvInt("BITRATE_MAX", 64000),
+		Start:            getEnvInt("BITRATE_START", 32000),
+		MaxFrameDuration: getEnvMillis("FRAME_DURATION_MAX", 60*time.Millisecond),
+	}
+	if cfg.Min > cfg.Max {
+		log.Printf("Warning: BITRATE_MIN %d above BITRATE_MAX %d, swapping", cfg.Min, cfg.Max)
+		cfg.Min, cfg.Max = cfg.Max, cfg.Min
+	}
+	cfg.Start = min(max(cfg.Start, cfg.Min), cfg.Max)
+	return cfg
+}
@@ -0,0 +1,16 @@
+package config
+
+// ChainConfig orders the audio processing stages of both directions
+type ChainConfig struct {
+	Capture  []string // stages run on captured audio, empty for the default order
+	Playback []string // stages run on received audio, empty for the default order
+	Bypass   []string // stages that start bypassed
+}
+
+func GetChainConfig() ChainConfig {
+	return ChainConfig{
+		Capture:  getEnvList("CAPTURE_CHAIN"),
+		Playback: getEnvList("PLAYBACK_CHAIN"),
+		Bypass:   getEnvList("CHAIN_BYPASS"),
+	}
+}
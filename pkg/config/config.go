@@ -31,20 +31,22 @@ func GetStunServers() []webrtc.ICEServer {
 	}
 	return stunServers
 }
+
+// GetTurnServers returns TURN servers with static credentials, per server credentials take precedence
 func GetTurnServers() []webrtc.ICEServer {
-	username := os.Getenv("TURN_USERNAME")
-	credential := os.Getenv("TURN_CREDENTIAL")
-	envServer := os.Getenv("TURN_SERVERS")
-	if envServer == "" {
+	cfg := GetTurnConfig()
+	if len(cfg.Servers) == 0 {
 		log.Println("Warning: TURN server configuration missing in environment, some connections may fail")
 	}
 
-	serverList := getServersFromString(envServer)
-
-	turnServers := make([]webrtc.ICEServer, len(serverList))
-	for i, server := range serverList {
+	turnServers := make([]webrtc.ICEServer, len(cfg.Servers))
+	for i, server := range cfg.Servers {
+		username, credential := cfg.Username, cfg.Credential
+		if server.Username != "" {
+			username, credential = server.Username, server.Credential
+		}
 		turnServers[i] = webrtc.ICEServer{
-			URLs:       []string{server},
+			URLs:       []string{server.URL},
 			Username:   username,
 			Credential: credential,
 		}
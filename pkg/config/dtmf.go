@@ -0,0 +1,27 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// maxDTMFDuration fits the 16 bit duration field of a telephone event at 48 kHz, the highest clock rate used
+const maxDTMFDuration = 0xFFFF * time.Second / 48000
+
+// DTMFConfig controls outgoing telephone events (RFC 4733)
+type DTMFConfig struct {
+	Duration time.Duration // how long each digit is held
+	Gap      time.Duration // pause between digits
+}
+
+func GetDTMFConfig() DTMFConfig {
+	cfg := DTMFConfig{
+		Duration: getEnvMillis("DTMF_DURATION", 100*time.Millisecond),
+		Gap:      getEnvMillis("DTMF_GAP", 70*time.Millisecond),
+	}
+	if cfg.Duration > maxDTMFDuration {
+		log.Printf("Warning: DTMF_DURATION %v above %v, using %v", cfg.Duration, maxDTMFDuration, maxDTMFDuration.Truncate(time.Millisecond))
+		cfg.Duration = maxDTMFDuration.Truncate(time.Millisecond)
+	}
+	return cfg
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// DTXConfig controls silence suppression of the outgoing stream
+type DTXConfig struct {
+	Enabled  bool
+	Hangover time.Duration // speech keeps being sent this long after the level drops
+}
+
+func GetDTXConfig() DTXConfig {
+	return DTXConfig{
+		Enabled:  getEnvBool("DTX_ENABLED", true),
+		Hangover: getEnvMillis("DTX_HANGOVER", 200*time.Millisecond),
+	}
+}
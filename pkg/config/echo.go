@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// EchoConfig controls the echo test mode
+type EchoConfig struct {
+	Delay time.Duration // how long received audio is held before it is sent back
+}
+
+func GetEchoConfig() EchoConfig {
+	return EchoConfig{
+		Delay: getEnvMillis("ECHO_DELAY", time.Second),
+	}
+}
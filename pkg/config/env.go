@@ -0,0 +1,53 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnvInt reads an integer variable, falls back to def when unset or invalid
+func getEnvInt(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %d", key, value, def)
+		return def
+	}
+	return parsed
+}
+
+// getEnvBool reads a boolean variable, falls back to def when unset or invalid
+func getEnvBool(key string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %t", key, value, def)
+		return def
+	}
+	return parsed
+}
+
+// getEnvMillis reads a duration given in milliseconds, falls back to def when unset or invalid
+func getEnvMillis(key string, def time.Duration) time.Duration {
+	return time.Duration(getEnvInt(key, int(def/time.Millisecond))) * time.Millisecond
+}
+
+// getEnvList reads a comma separated variable, empty entries are skipped
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
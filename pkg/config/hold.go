@@ -0,0 +1,12 @@
+package config
+
+// HoldConfig controls what the remote side hears while we hold the call
+type HoldConfig struct {
+	Music bool // play hold music instead of silence
+}
+
+func GetHoldConfig() HoldConfig {
+	return HoldConfig{
+		Music: getEnvBool("HOLD_MUSIC", true),
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// ICEConfig controls which candidates are gathered and used
+type ICEConfig struct {
+	RelayOnly  bool // use TURN candidates only so the peer never learns our address
+	MDNS       bool // hide host candidate addresses behind random .local names
+	UDP        bool
+	TCP        bool
+	Interfaces []string     // gather on these interfaces only, empty allows all
+	Excluded   []string     // never gather on these interfaces
+	AllowIPs   []*net.IPNet // gather these addresses only, empty allows all
+	DenyIPs    []*net.IPNet // never gather these addresses
+}
+
+func GetICEConfig() ICEConfig {
+	policy := strings.ToLower(strings.TrimSpace(os.Getenv("ICE_TRANSPORT_POLICY")))
+	if policy != "" && policy != "all" && policy != "relay" {
+		log.Printf("Warning: invalid ICE_TRANSPORT_POLICY=%q, using all", policy)
+	}
+
+	cfg := ICEConfig{
+		RelayOnly:  policy == "relay",
+		MDNS:       getEnvBool("ICE_MDNS", false),
+		UDP:        getEnvBool("ICE_UDP", true),
+		TCP:        getEnvBool("ICE_TCP", true),
+		Interfaces: getEnvList("ICE_INTERFACES"),
+		Excluded:   getEnvList("ICE_EXCLUDE_INTERFACES"),
+		AllowIPs:   getEnvNets("ICE_ALLOW_IPS"),
+		DenyIPs:    getEnvNets("ICE_DENY_IPS"),
+	}
+	if !cfg.UDP && !cfg.TCP {
+		log.Println("Warning: ICE_UDP and ICE_TCP both disabled, enabling UDP")
+		cfg.UDP = true
+	}
+	return cfg
+}
+
+// getEnvNets reads a list of CIDRs, single addresses are taken as a host network
+func getEnvNets(key string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range getEnvList(key) {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("Warning: invalid address %q in %s, ignoring", item, key)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
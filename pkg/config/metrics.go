@@ -0,0 +1,11 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// GetMetricsAddr returns the address the Prometheus endpoint listens on, empty disables it
+func GetMetricsAddr() string {
+	return strings.TrimSpace(os.Getenv("METRICS_ADDR"))
+}
@@ -0,0 +1,14 @@
+package config
+
+// NoiseConfig controls suppression of background noise on the microphone signal
+type NoiseConfig struct {
+	Enabled bool
+	Level   int // aggressiveness, 0 (low) to 3 (very high)
+}
+
+func GetNoiseConfig() NoiseConfig {
+	return NoiseConfig{
+		Enabled: getEnvBool("NS_ENABLED", true),
+		Level:   getEnvInt("NS_LEVEL", 1),
+	}
+}
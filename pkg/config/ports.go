@@ -0,0 +1,52 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// PortConfig pins ICE to known ports so the app can run behind a firewall or in a container
+type PortConfig struct {
+	UDPPortMin int // ephemeral UDP range for candidates, 0 lets the OS choose
+	UDPPortMax int
+	UDPMuxPort int // serve all ICE UDP traffic on this one port, 0 disables
+	TCPPort    int // passive ICE-TCP listener, 0 disables
+
+	NAT1To1IPs   []string // public addresses of a 1:1 NAT in front of this host
+	NAT1To1Srflx bool     // announce the public addresses as srflx candidates instead of rewriting host candidates
+}
+
+func GetPortConfig() PortConfig {
+	cfg := PortConfig{
+		UDPPortMin: getEnvPort("ICE_UDP_PORT_MIN"),
+		UDPPortMax: getEnvPort("ICE_UDP_PORT_MAX"),
+		UDPMuxPort: getEnvPort("ICE_UDP_MUX_PORT"),
+		TCPPort:    getEnvPort("ICE_TCP_PORT"),
+		NAT1To1IPs: getEnvList("NAT_1TO1_IPS"),
+	}
+
+	if (cfg.UDPPortMin == 0) != (cfg.UDPPortMax == 0) || cfg.UDPPortMin > cfg.UDPPortMax {
+		log.Printf("Warning: invalid UDP port range %d-%d, using any port", cfg.UDPPortMin, cfg.UDPPortMax)
+		cfg.UDPPortMin, cfg.UDPPortMax = 0, 0
+	}
+
+	switch candidate := strings.ToLower(strings.TrimSpace(os.Getenv("NAT_1TO1_CANDIDATE"))); candidate {
+	case "", "host":
+	case "srflx":
+		cfg.NAT1To1Srflx = true
+	default:
+		log.Printf("Warning: invalid NAT_1TO1_CANDIDATE=%q, using host", candidate)
+	}
+	return cfg
+}
+
+// getEnvPort reads a port number, 0 when unset or out of range
+func getEnvPort(key string) int {
+	port := getEnvInt(key, 0)
+	if port < 0 || port > 65535 {
+		log.Printf("Warning: invalid %s=%d, ignoring", key, port)
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,16 @@
+package config
+
+// RedConfig controls redundant audio (RFC 2198)
+type RedConfig struct {
+	Enabled       bool    // offer audio/red during negotiation
+	Distance      int     // previous frames repeated in every packet, capped by the encoder
+	LossThreshold float64 // fraction lost that switches redundancy on
+}
+
+func GetRedConfig() RedConfig {
+	return RedConfig{
+		Enabled:       getEnvBool("RED_ENABLED", true),
+		Distance:      max(getEnvInt("RED_DISTANCE", 1), 1),
+		LossThreshold: float64(getEnvInt("RED_LOSS_PERCENT", 10)) / 100,
+	}
+}
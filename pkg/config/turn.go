@@ -0,0 +1,69 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// TurnServer is one TURN url with its own credentials, empty credentials use the shared ones
+type TurnServer struct {
+	URL        string
+	Username   string
+	Credential string
+}
+
+// TurnConfig describes TURN servers and where their credentials come from:
+// static username/credential, a shared secret (TURN REST API) or an HTTP credentials endpoint
+type TurnConfig struct {
+	Servers        []TurnServer
+	Username       string
+	Credential     string
+	Secret         string        // shared secret to compute time limited credentials
+	CredentialsURL string        // endpoint returning time limited credentials
+	TTL            time.Duration // lifetime of computed credentials
+}
+
+func GetTurnConfig() TurnConfig {
+	cfg := TurnConfig{
+		Username:       os.Getenv("TURN_USERNAME"),
+		Credential:     os.Getenv("TURN_CREDENTIAL"),
+		Secret:         os.Getenv("TURN_SECRET"),
+		CredentialsURL: strings.TrimSpace(os.Getenv("TURN_CREDENTIALS_URL")),
+		TTL:            time.Duration(getEnvInt("TURN_CREDENTIAL_TTL", 86400)) * time.Second,
+	}
+	for _, entry := range getEnvList("TURN_SERVERS") {
+		server, ok := parseTurnServer(entry)
+		if !ok {
+			log.Printf("Warning: invalid TURN server %q, ignoring", entry)
+			continue
+		}
+		cfg.Servers = append(cfg.Servers, server)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	return cfg
+}
+
+// parseTurnServer reads "turn:host:port" or "user:credential@turns:host:port?transport=tcp"
+func parseTurnServer(entry string) (TurnServer, bool) {
+	var server TurnServer
+	for _, scheme := range []string{"@turn:", "@turns:"} {
+		if i := strings.Index(entry, scheme); i >= 0 {
+			user, credential, ok := strings.Cut(entry[:i], ":")
+			if !ok {
+				return server, false
+			}
+			server.Username, server.Credential = user, credential
+			entry = entry[i+1:]
+			break
+		}
+	}
+	if !strings.HasPrefix(entry, "turn:") && !strings.HasPrefix(entry, "turns:") {
+		return server, false
+	}
+	server.URL = entry
+	return server, true
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// TurnServerConfig configures the embedded STUN/TURN server mode
+type TurnServerConfig struct {
+	ListenAddr string // UDP (and TCP) address to serve STUN/TURN on
+	PublicIP   string // address relayed candidates are announced with
+	Realm      string
+	Users      map[string]string // static username -> password
+	Secret     string            // shared secret for time limited TURN REST credentials
+	PortMin    int               // relay port range
+	PortMax    int
+	TCP        bool // also accept TURN over TCP on ListenAddr
+}
+
+func GetTurnServerConfig() TurnServerConfig {
+	cfg := TurnServerConfig{
+		ListenAddr: os.Getenv("TURN_SERVER_LISTEN"),
+		PublicIP:   strings.TrimSpace(os.Getenv("TURN_SERVER_PUBLIC_IP")),
+		Realm:      os.Getenv("TURN_SERVER_REALM"),
+		Users:      make(map[string]string),
+		Secret:     os.Getenv("TURN_SERVER_SECRET"),
+		PortMin:    getEnvPort("TURN_SERVER_PORT_MIN"),
+		PortMax:    getEnvPort("TURN_SERVER_PORT_MAX"),
+		TCP:        getEnvBool("TURN_SERVER_TCP", true),
+	}
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = "0.0.0.0:3478"
+	}
+	if cfg.Realm == "" {
+		cfg.Realm = "p2p-call"
+	}
+	if cfg.PortMin == 0 || cfg.PortMax == 0 || cfg.PortMin > cfg.PortMax {
+		cfg.PortMin, cfg.PortMax = 49152, 65535
+	}
+	for _, entry := range getEnvList("TURN_SERVER_USERS") {
+		user, password, ok := strings.Cut(entry, "=")
+		if !ok || user == "" {
+			log.Printf("Warning: invalid TURN_SERVER_USERS entry %q, expected user=password", entry)
+			continue
+		}
+		cfg.Users[user] = password
+	}
+	return cfg
+}
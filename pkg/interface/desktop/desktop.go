@@ -5,30 +5,100 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"p2p-call/internal/audio/capture"
-	"p2p-call/internal/audio/playback"
+	"p2p-call/internal/audio/chain"
+	"p2p-call/internal/audio/device"
+	"p2p-call/internal/audio/dsp"
+	"p2p-call/internal/audio/pipeline"
+	"p2p-call/internal/rtc/latency"
+	"p2p-call/internal/rtc/quality"
+	"p2p-call/pkg/system"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CallControl is the in-call functionality of the connection used by the interface
+type CallControl interface {
+	SendDTMF(digits string) error
+	OnDTMF(handler func(digit rune))
+	RemoteAudioLevel() (dBov int, speaking bool)
+	Quality() (score quality.Score, ok bool)
+	QualitySummary() quality.Summary
+	OnQualityWarning(handler func(score quality.Score))
+	Latency() (breakdown latency.Breakdown, ok bool)
+	EchoStats() (stats dsp.EchoStats, ok bool)
+	NoiseSuppression() (on, ok bool)
+	SetNoiseSuppression(on bool) (ok bool)
+	InputGain() (dB float64, automatic, ok bool)
+	SetInputGain(dB float64) (ok bool)
+	SetAutomaticGain(automatic bool) (ok bool)
+	ProcessingStages() (capture, playback []chain.StageStats)
+	SetStageBypass(name string, bypassed bool) error
+	Hold() error
+	Resume() error
+	OnHoldChange(handler func(local, remote bool))
+}
+
+const (
+	voiceCheckInterval = 100 * time.Millisecond
+	mutedTalkWarnAfter = time.Second            // talking while muted this long is pointed out
+	mutedTalkWarnEvery = 10 * time.Second       // at most this often
+	pttFirstRepeat     = 700 * time.Millisecond // a held key repeats after the terminal's delay, longer than this counts as released
+	pttRepeat          = 150 * time.Millisecond // and then faster
+	ctrlC              = 0x03                   // push-to-talk input delivers it as a key instead of a signal
 )
 
 type DesktopInterface struct {
-	capture  *capture.MalgoCapture
-	playback *playback.MalgoPlayback
+	capture   pipeline.CaptureSource
+	playback  pipeline.PlaybackSink
+	call      CallControl
+	showVoice atomic.Bool // print when voice starts and stops
+	ptt       atomic.Bool // push-to-talk decides mute
 }
 
-func NewDesktopInterface(capture *capture.MalgoCapture, playback *playback.MalgoPlayback) (*DesktopInterface, error) {
-	if capture == nil || playback == nil {
+func NewDesktopInterface(capture pipeline.CaptureSource, playback pipeline.PlaybackSink, call CallControl) (*DesktopInterface, error) {
+	if capture == nil || playback == nil || call == nil {
 		return nil, fmt.Errorf("pparams cant be nill")
 	}
+	call.OnDTMF(func(digit rune) {
+		fmt.Printf("\nRemote pressed %c\n", digit)
+	})
+	call.OnQualityWarning(func(score quality.Score) {
+		fmt.Printf("\nWarning: call quality dropped (MOS %.1f)\n", score.MOS)
+	})
+	call.OnHoldChange(func(local, remote bool) {
+		switch {
+		case local:
+			fmt.Println("\nCall is on hold")
+		case remote:
+			fmt.Println("\nRemote put you on hold")
+		default:
+			fmt.Println("\nCall resumed")
+		}
+	})
+	for _, backend := range []any{capture, playback} {
+		if switcher, ok := backend.(pipeline.DeviceSwitcher); ok {
+			switcher.OnDeviceChange(func(change device.Change) {
+				fmt.Printf("\n%s\n", change)
+			})
+		}
+	}
 	return &DesktopInterface{
 		capture:  capture,
 		playback: playback,
+		call:     call,
 	}, nil
 }
 
 func (di *DesktopInterface) StartDesktopInterface() {
 	// Implementation for starting the desktop interface
 	log.Println("Preparing audio capture and playback")
-	menu := "1. Unmute\n2. Mute\n3. Play sound\n 4. Stop sound\n5. Exit"
+	done := make(chan struct{})
+	defer close(done)
+	go di.watchVoice(done)
+
+	menu := "1. Unmute\n2. Mute\n3. Play sound\n 4. Stop sound\n5. Exit\n6. Send DTMF digits\n7. Call status\n8. Hold\n9. Resume\n10. Switch input device\n11. Switch output device\n12. Noise suppression on/off\n13. Input gain\n14. Voice indicator on/off\n15. Push-to-talk\n16. Processing stages"
 	println("Desktop Interface Started\nBy default u are muted and sound is on")
 	println("Menu:")
 	println(menu)
@@ -41,21 +111,327 @@ func (di *DesktopInterface) StartDesktopInterface() {
 		switch input {
 		case "1":
 			println("Unmuted")
-			di.capture.Paused = false
+			di.capture.SetPaused(false)
 		case "2":
 			println("Muted")
-			di.capture.Paused = true
+			di.capture.SetPaused(true)
 		case "3":
 			println("Playing sound")
-			di.playback.Paused = false
+			di.playback.SetPaused(false)
 		case "4":
 			println("Stopping sound")
-			di.playback.Paused = true
+			di.playback.SetPaused(true)
 		case "5":
 			println("Exiting...")
+			di.printSummary()
 			return
+		case "6":
+			print("Digits (0-9 * # A-D): ")
+			digits, _ := reader.ReadString('\n')
+			digits = strings.ToUpper(strings.TrimSpace(digits))
+			if err := di.call.SendDTMF(digits); err != nil {
+				println("Failed to send DTMF:", err.Error())
+			} else {
+				println("Sent", digits)
+			}
+		case "7":
+			di.printStatus()
+		case "8":
+			if err := di.call.Hold(); err != nil {
+				println("Failed to hold:", err.Error())
+			}
+		case "9":
+			if err := di.call.Resume(); err != nil {
+				println("Failed to resume:", err.Error())
+			}
+		case "10":
+			di.switchDevice(reader, di.capture, true)
+		case "11":
+			di.switchDevice(reader, di.playback, false)
+		case "12":
+			di.toggleNoiseSuppression()
+		case "13":
+			di.setInputGain(reader)
+		case "14":
+			show := !di.showVoice.Load()
+			di.showVoice.Store(show)
+			fmt.Printf("Voice indicator %s\n", onOff(show))
+		case "15":
+			di.pushToTalk(reader)
+		case "16":
+			di.processingStages(reader)
 		default:
 			println("Invalid choice, please try again.")
 		}
 	}
 }
+
+// switchDevice lists the sound cards and moves input or output to the one chosen, the call continues
+func (di *DesktopInterface) switchDevice(reader *bufio.Reader, backend any, input bool) {
+	switcher, ok := backend.(pipeline.DeviceSwitcher)
+	if !ok {
+		println("Audio is not going through a sound card, see AUDIO_INPUT and AUDIO_OUTPUT")
+		return
+	}
+
+	capture, playback, err := device.Devices()
+	if err != nil {
+		println("Failed to list devices:", err.Error())
+		return
+	}
+	if input {
+		device.Print(os.Stdout, "Capture devices", capture)
+	} else {
+		device.Print(os.Stdout, "Playback devices", playback)
+	}
+
+	print("Device id or name (empty for default): ")
+	selector, _ := reader.ReadString('\n')
+	if err := switcher.SwitchDevice(strings.TrimSpace(selector)); err != nil {
+		println("Failed to switch device:", err.Error())
+		return
+	}
+	println("Device switched")
+}
+
+// watchVoice shows the voice indicator and warns when talking while muted, until done is closed
+func (di *DesktopInterface) watchVoice(done <-chan struct{}) {
+	ticker := time.NewTicker(voiceCheckInterval)
+	defer ticker.Stop()
+	var mutedTalk time.Duration
+	var lastWarning time.Time
+	wasTalking := false
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			talking := di.capture.Talking()
+			if talking != wasTalking && di.showVoice.Load() {
+				if talking {
+					fmt.Println("\n[voice detected]")
+				} else {
+					fmt.Println("\n[silence]")
+				}
+			}
+			wasTalking = talking
+
+			if talking && di.capture.Paused() && !di.ptt.Load() {
+				mutedTalk += voiceCheckInterval
+			} else {
+				mutedTalk = 0
+			}
+			if mutedTalk >= mutedTalkWarnAfter && now.Sub(lastWarning) >= mutedTalkWarnEvery {
+				fmt.Println("\nYou are muted but talking, press 1 to unmute")
+				lastWarning = now
+			}
+		}
+	}
+}
+
+// pushToTalk sends the microphone only while space is held. The terminal only reports key presses,
+// a held key repeats, so the key counts as released once the repeats stop.
+func (di *DesktopInterface) pushToTalk(reader *bufio.Reader) {
+	restore, err := system.RawInput()
+	if err != nil {
+		println("Push-to-talk needs an interactive terminal:", err.Error())
+		return
+	}
+	defer restore()
+
+	wasPaused := di.capture.Paused()
+	di.ptt.Store(true)
+	di.capture.SetPaused(true)
+	defer func() {
+		di.capture.SetPaused(wasPaused)
+		di.ptt.Store(false)
+	}()
+	println("Push-to-talk: hold space to talk, q to leave")
+
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		for {
+			key, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			keys <- key
+			if key == 'q' || key == 'Q' || key == ctrlC {
+				return // the menu reads the input again
+			}
+		}
+	}()
+
+	release := time.NewTimer(pttFirstRepeat)
+	release.Stop()
+	held := false
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 'Q' || key == ctrlC {
+				println("Push-to-talk off")
+				return
+			}
+			if key != ' ' {
+				continue
+			}
+			if held {
+				release.Reset(pttRepeat)
+				continue
+			}
+			held = true
+			di.capture.SetPaused(false)
+			println("Talking")
+			release.Reset(pttFirstRepeat)
+		case <-release.C:
+			held = false
+			di.capture.SetPaused(true)
+			println("Muted")
+		}
+	}
+}
+
+// processingStages lists the processing stages of both directions and switches one on or off
+func (di *DesktopInterface) processingStages(reader *bufio.Reader) {
+	capture, playback := di.call.ProcessingStages()
+	printStages("Capture", capture)
+	printStages("Playback", playback)
+
+	print("Stage to switch on/off (empty to leave): ")
+	name, _ := reader.ReadString('\n')
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	bypassed := false
+	for _, stage := range append(capture, playback...) {
+		if stage.Name == name {
+			bypassed = stage.Bypassed
+		}
+	}
+	if err := di.call.SetStageBypass(name, !bypassed); err != nil {
+		println("Failed to switch stage:", err.Error())
+		return
+	}
+	fmt.Printf("Stage %s %s\n", name, onOff(bypassed))
+}
+
+func printStages(direction string, stages []chain.StageStats) {
+	fmt.Printf("%s:\n", direction)
+	for _, stage := range stages {
+		state := "on"
+		switch {
+		case !stage.Registered:
+			state = "not enabled"
+		case stage.Bypassed:
+			state = "bypassed"
+		}
+		fmt.Printf("  %-7s %-11s %.2f ms/frame, delay %d ms, %d frames, %d dropped\n", stage.Name, state,
+			float64(stage.Time.Microseconds())/1000, stage.Delay.Milliseconds(), stage.Blocks, stage.Dropped)
+	}
+}
+
+// toggleNoiseSuppression switches noise suppression off when it is on and back on
+func (di *DesktopInterface) toggleNoiseSuppression() {
+	on, ok := di.call.NoiseSuppression()
+	if !ok {
+		println("Noise suppression is not enabled, see NS_ENABLED")
+		return
+	}
+	di.call.SetNoiseSuppression(!on)
+	if on {
+		println("Noise suppression off")
+	} else {
+		println("Noise suppression on")
+	}
+}
+
+// setInputGain switches to automatic gain control or a fixed gain in dB
+func (di *DesktopInterface) setInputGain(reader *bufio.Reader) {
+	if _, _, ok := di.call.InputGain(); !ok {
+		println("Input gain is not adjustable")
+		return
+	}
+	print("Gain in dB, or auto: ")
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, "auto") {
+		di.call.SetAutomaticGain(true)
+		println("Automatic gain control on")
+		return
+	}
+	dB, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		println("Invalid gain:", input)
+		return
+	}
+	di.call.SetInputGain(dB)
+	fmt.Printf("Input gain %+.1f dB\n", dB)
+}
+
+// printStatus shows the live state of the call
+func (di *DesktopInterface) printStatus() {
+	you := "silent"
+	if di.capture.Talking() {
+		you = "talking"
+	}
+	if di.capture.Paused() {
+		you += " (muted)"
+	}
+	fmt.Printf("You: %s\n", you)
+
+	level, speaking := di.call.RemoteAudioLevel()
+	state := "silent"
+	if speaking {
+		state = "talking"
+	}
+	fmt.Printf("Remote: %s (level %d dBov)\n", state, level)
+
+	if score, ok := di.call.Quality(); ok {
+		fmt.Printf("Quality: MOS %.1f (R %.0f)\n", score.MOS, score.R)
+	} else {
+		println("Quality: no audio received yet")
+	}
+
+	if b, ok := di.call.Latency(); ok {
+		network := "rtt/2"
+		if b.Measured {
+			network = "measured"
+		}
+		fmt.Printf("Latency: %d ms (capture %d, network %d %s, buffer %d, playback %d, rtt %d)\n",
+			b.Total().Milliseconds(), b.Capture.Milliseconds(), b.Network.Milliseconds(), network,
+			b.Buffer.Milliseconds(), b.Playback.Milliseconds(), b.RTT.Milliseconds())
+	}
+
+	if echo, ok := di.call.EchoStats(); ok {
+		fmt.Printf("Echo cancellation: delay %d ms, removes %.0f dB, double talk %t\n",
+			echo.Delay.Milliseconds(), echo.ERLE, echo.DoubleTalk)
+	}
+	if on, ok := di.call.NoiseSuppression(); ok {
+		fmt.Printf("Noise suppression: %t\n", on)
+	}
+	if dB, automatic, ok := di.call.InputGain(); ok {
+		mode := "manual"
+		if automatic {
+			mode = "automatic"
+		}
+		fmt.Printf("Input gain: %+.1f dB (%s)\n", dB, mode)
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// printSummary shows the quality spread of the whole call
+func (di *DesktopInterface) printSummary() {
+	summary := di.call.QualitySummary()
+	if summary.Samples == 0 {
+		return
+	}
+	fmt.Printf("Call quality MOS: min %.1f, avg %.1f, max %.1f\n", summary.Min, summary.Avg, summary.Max)
+}
@@ -0,0 +1,23 @@
+package system
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// RawInput switches the terminal to deliver key presses one at a time without echo,
+// restore switches it back. Ctrl+C arrives as a key meanwhile. Output is left as it is,
+// so lines written by anything else still start at the left edge. Fails when stdin is not a terminal.
+func RawInput() (restore func(), err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("stdin is not a terminal")
+	}
+	restore, err = keyInput(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch terminal to raw input: %w", err)
+	}
+	return restore, nil
+}
@@ -0,0 +1,10 @@
+//go:build aix || linux || solaris || zos
+
+package system
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
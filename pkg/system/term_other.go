@@ -0,0 +1,14 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || zos)
+
+package system
+
+import "golang.org/x/term"
+
+// keyInput uses raw mode, the Windows console keeps processing output in it
+func keyInput(fd int) (func(), error) {
+	saved, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = term.Restore(fd, saved) }, nil
+}